@@ -0,0 +1,77 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// lockedBase defines a base image recorded in the base lockfile.
+type lockedBase struct {
+	Image  string   `json:"image"`  // Base image as referenced in the Dockerfile
+	Digest string   `json:"digest"` // Digest of the base image used by the build
+	Stages []string `json:"stages"` // Stages built from the base image
+}
+
+// helper function to return the external base images of the build
+// stages in Dockerfile order. Stages built from an earlier stage and
+// scratch stages are skipped, and each image is listed once with the
+// stages using it. Unnamed stages are listed by their index.
+func baseImages(stages []stage) []lockedBase {
+	var (
+		bases []lockedBase
+		index = map[string]int{}
+		names = map[string]bool{}
+	)
+	for i, st := range stages {
+		name := st.Name
+		if name == "" {
+			name = fmt.Sprint(i)
+		}
+		switch {
+		case names[st.Base], st.Base == "scratch":
+		case index[st.Base] == 0:
+			bases = append(bases, lockedBase{Image: st.Base, Stages: []string{name}})
+			index[st.Base] = len(bases)
+		default:
+			base := &bases[index[st.Base]-1]
+			base.Stages = append(base.Stages, name)
+		}
+		if st.Name != "" {
+			names[st.Name] = true
+		}
+	}
+	return bases
+}
+
+// helper function to write the digests of the base images the build
+// pulled to the lockfile, replacing any previous contents. The digests
+// are read from the images in local storage, so the registry is not
+// queried.
+func (p Plugin) writeBaseLock(path string) error {
+	list, err := readDockerfile(p.Build.Dockerfile)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", p.Build.Dockerfile, err)
+	}
+	bases := baseImages(parseStages(list, p.Build.Args))
+	for i, base := range bases {
+		info, err := p.inspect(base.Image)
+		if err != nil {
+			return err
+		}
+		if info.FromImageDigest == "" {
+			return fmt.Errorf("Error resolving the digest of base image %s", base.Image)
+		}
+		bases[i].Digest = info.FromImageDigest
+	}
+
+	data, err := json.MarshalIndent(append([]lockedBase{}, bases...), "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("Error writing base lockfile: %s", err)
+	}
+
+	fmt.Printf("Base image digests written to %s\n", path)
+	return nil
+}
@@ -0,0 +1,30 @@
+package docker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_baseImages(t *testing.T) {
+	dockerfile := `ARG GO_VERSION=1.12
+FROM golang:${GO_VERSION} AS build
+FROM alpine:3.10 AS base
+FROM base AS release
+FROM golang:1.13 AS test
+FROM scratch
+FROM alpine:3.10
+`
+	list, err := parseDockerfile(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := baseImages(parseStages(list, []string{"GO_VERSION=1.13"}))
+	want := []lockedBase{
+		{Image: "golang:1.13", Stages: []string{"build", "test"}},
+		{Image: "alpine:3.10", Stages: []string{"base", "5"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got base images %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"encoding/json"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// default label key the build info is stamped under.
+const defaultBuildInfoKey = "io.drone.build-info"
+
+// matches build arg names that likely hold secrets.
+var secretArg = regexp.MustCompile(`(?i)pass|secret|token|key|cred|auth`)
+
+// buildInfo defines the sanitized build configuration stamped on the
+// image. Credentials and secret build args are never included.
+type buildInfo struct {
+	Dockerfile    string   `json:"dockerfile"`
+	Context       string   `json:"context"`
+	Target        string   `json:"target,omitempty"`
+	StorageDriver string   `json:"storage_driver"`
+	Flags         []string `json:"flags,omitempty"`
+	Args          []string `json:"args,omitempty"`
+	CacheFrom     []string `json:"cache_from,omitempty"`
+}
+
+// helper function to return the build info label key.
+func (b Build) buildInfoKey() string {
+	if b.BuildInfoLabelKey == "" {
+		return defaultBuildInfoKey
+	}
+	return b.BuildInfoLabelKey
+}
+
+// helper function to serialize the sanitized build configuration.
+func buildInfoLabel(build Build) string {
+	info := buildInfo{
+		Dockerfile:    build.Dockerfile,
+		Context:       build.Context,
+		Target:        build.Target,
+		StorageDriver: build.storageDriver(),
+		CacheFrom:     build.cacheFrom(),
+	}
+	flags := []struct {
+		name string
+		set  bool
+	}{
+		{"compress", build.Compress},
+		{"layers", build.Layers},
+		{"no-cache", build.NoCache},
+		{"pull", build.Pull},
+		{"quiet", build.Quiet},
+		{"squash", build.Squash && !build.SquashAll},
+		{"squash-all", build.SquashAll},
+		{"omit-history", build.OmitHistory},
+	}
+	for _, flag := range flags {
+		if flag.set {
+			info.Flags = append(info.Flags, flag.name)
+		}
+	}
+	for _, arg := range build.Args {
+		parts := strings.SplitN(arg, "=", 2)
+		if secretArg.MatchString(parts[0]) {
+			continue
+		}
+		if len(parts) == 2 {
+			arg = parts[0] + "=" + stripUserinfo(parts[1])
+		}
+		info.Args = append(info.Args, arg)
+	}
+
+	data, _ := json.Marshal(info)
+	return string(data)
+}
+
+// helper function to remove the credentials from a URL value, such as
+// a proxy URL. Values that are not URLs are returned unchanged.
+func stripUserinfo(value string) string {
+	u, err := url.Parse(value)
+	if err != nil || u.User == nil {
+		return value
+	}
+	u.User = nil
+	return u.String()
+}
@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// cacheStats defines a writer counting the layer cache hits and misses
+// from the build output.
+type cacheStats struct {
+	steps int          // Cacheable steps seen
+	hits  int          // Steps that used the cache
+	line  bytes.Buffer // Partial line not yet parsed
+}
+
+func (s *cacheStats) Write(p []byte) (int, error) {
+	s.line.Write(p)
+	for {
+		i := bytes.IndexByte(s.line.Bytes(), '\n')
+		if i == -1 {
+			return len(p), nil
+		}
+		s.parse(string(s.line.Next(i + 1)))
+	}
+}
+
+// helper function to count a single line of build output. Each STEP
+// other than FROM is cacheable, and buildah reports the steps taken
+// from the cache with "Using cache".
+func (s *cacheStats) parse(line string) {
+	line = strings.TrimSpace(line)
+	switch {
+	case strings.HasPrefix(line, "STEP "):
+		parts := strings.SplitN(line, ": ", 2)
+		if len(parts) == 2 && !strings.HasPrefix(strings.ToUpper(parts[1]), "FROM ") {
+			s.steps++
+		}
+	case strings.HasPrefix(line, "--> Using cache"):
+		s.hits++
+	}
+}
+
+// helper function to print the cache statistics.
+func (s *cacheStats) report() {
+	if s.line.Len() != 0 {
+		s.parse(s.line.String())
+		s.line.Reset()
+	}
+	misses := s.steps - s.hits
+	if misses < 0 {
+		misses = 0
+	}
+	fmt.Printf("Build cache stats: cache_hits=%d cache_misses=%d\n", s.hits, misses)
+}
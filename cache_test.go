@@ -0,0 +1,36 @@
+package docker
+
+import (
+	"io"
+	"strings"
+	"testing"
+)
+
+func Test_cacheStats(t *testing.T) {
+	output := `STEP 1/5: FROM golang:1.13 AS build
+STEP 2/5: COPY . .
+--> Using cache 1c7fe4a2b3
+--> 1c7fe4a2b3
+STEP 3/5: RUN go build ./...
+--> 8f2a9c1d4e
+STEP 4/5: FROM scratch
+STEP 5/5: COPY --from=build /go/bin/app /bin/app
+--> Using cache 3e4d5f6a7b`
+
+	stats := new(cacheStats)
+	// write in small chunks to split lines across writes
+	r := strings.NewReader(output)
+	buf := make([]byte, 7)
+	for {
+		n, err := r.Read(buf)
+		stats.Write(buf[:n])
+		if err == io.EOF {
+			break
+		}
+	}
+	stats.report()
+
+	if stats.steps != 3 || stats.hits != 2 {
+		t.Errorf("Got %d steps and %d hits, want 3 steps and 2 hits", stats.steps, stats.hits)
+	}
+}
@@ -0,0 +1,79 @@
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// helper function to return the registry hosts of the cache-from and
+// cache-to repositories, defaulting to Docker Hub.
+func (b Build) cacheHosts() []string {
+	var hosts []string
+	for _, repo := range append(b.cacheFrom(), b.CacheTo...) {
+		host, _ := splitRepo(repo)
+		if host == "" {
+			host = "docker.io"
+		}
+		hosts = append(hosts, host)
+	}
+	return uniqueTags(hosts)
+}
+
+// helper function to return the auth file buildah reads the login
+// credentials from.
+func authFilePath() string {
+	if path := os.Getenv("REGISTRY_AUTH_FILE"); path != "" {
+		return path
+	}
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "containers", "auth.json")
+	}
+	return fmt.Sprintf("/run/containers/%d/auth.json", os.Getuid())
+}
+
+// helper function to write the auth file the build uses: a copy of the
+// login auth file with the cache registry credentials set for the cache
+// registry hosts only. The base image and push registries keep the
+// login credentials, so the cache credentials are never sent to them. A
+// cache host that already has login credentials keeps them, so the
+// push to the same registry is not made with the cache credentials.
+func (p Plugin) writeCacheAuth() (string, error) {
+	config := map[string]json.RawMessage{}
+	data, err := ioutil.ReadFile(authFilePath())
+	switch {
+	case err == nil:
+		if err := json.Unmarshal(data, &config); err != nil {
+			return "", fmt.Errorf("Error parsing %s: %s", authFilePath(), err)
+		}
+	case !os.IsNotExist(err):
+		return "", err
+	}
+
+	auths := map[string]json.RawMessage{}
+	if raw, ok := config["auths"]; ok {
+		if err := json.Unmarshal(raw, &auths); err != nil {
+			return "", fmt.Errorf("Error parsing %s: %s", authFilePath(), err)
+		}
+	}
+	auth, _ := json.Marshal(map[string]string{
+		"auth": base64.StdEncoding.EncodeToString([]byte(p.Build.CacheRegistryCreds)),
+	})
+	for _, host := range p.Build.cacheHosts() {
+		if _, ok := auths[host]; ok {
+			fmt.Printf("Registry %s already has login credentials. Skipping the cache credentials...\n", host)
+			continue
+		}
+		auths[host] = auth
+	}
+	if config["auths"], err = json.Marshal(auths); err != nil {
+		return "", err
+	}
+	if data, err = json.Marshal(config); err != nil {
+		return "", err
+	}
+	return p.work.writeFile("auth-cache-*.json", data)
+}
@@ -0,0 +1,65 @@
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteCacheAuth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	login := filepath.Join(dir, "auth.json")
+	data := `{"auths":{"registry.example.com":{"auth":"bG9naW46c2VjcmV0"}},"credHelpers":{"gcr.io":"gcloud"}}`
+	if err := ioutil.WriteFile(login, []byte(data), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if path, ok := os.LookupEnv("REGISTRY_AUTH_FILE"); ok {
+		defer os.Setenv("REGISTRY_AUTH_FILE", path)
+	} else {
+		defer os.Unsetenv("REGISTRY_AUTH_FILE")
+	}
+	os.Setenv("REGISTRY_AUTH_FILE", login)
+
+	p := Plugin{
+		Build: Build{
+			CacheFrom:          []string{"cache.example.com/hello-world", "registry.example.com/octocat/cache"},
+			CacheTo:            []string{"octocat/cache"},
+			CacheRegistryCreds: "octocat:correct-horse",
+		},
+		work: &workdir{home: dir},
+	}
+	path, err := p.writeCacheAuth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got struct {
+		Auths       map[string]map[string]string `json:"auths"`
+		CredHelpers map[string]string            `json:"credHelpers"`
+	}
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]map[string]string{
+		"registry.example.com": {"auth": "bG9naW46c2VjcmV0"},
+		"cache.example.com":    {"auth": "b2N0b2NhdDpjb3JyZWN0LWhvcnNl"},
+		"docker.io":            {"auth": "b2N0b2NhdDpjb3JyZWN0LWhvcnNl"},
+	}
+	if !reflect.DeepEqual(got.Auths, want) {
+		t.Errorf("Got auths %v, want %v", got.Auths, want)
+	}
+	if got.CredHelpers["gcr.io"] != "gcloud" {
+		t.Errorf("Expect the other auth file settings kept, got %s", out)
+	}
+}
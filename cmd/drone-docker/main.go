@@ -1,7 +1,10 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"github.com/sirupsen/logrus"
@@ -31,6 +34,11 @@ func main() {
 			Usage:  "dry run disables docker push",
 			EnvVar: "PLUGIN_DRY_RUN",
 		},
+		cli.BoolFlag{
+			Name:   "preview",
+			Usage:  "print the commands without running them",
+			EnvVar: "PLUGIN_PREVIEW",
+		},
 		cli.StringFlag{
 			Name:   "remote.url",
 			Usage:  "git remote url",
@@ -42,6 +50,11 @@ func main() {
 			EnvVar: "DRONE_COMMIT_SHA",
 			Value:  "00000000",
 		},
+		cli.StringFlag{
+			Name:   "commit.branch",
+			Usage:  "git commit branch",
+			EnvVar: "DRONE_COMMIT_BRANCH",
+		},
 		cli.StringFlag{
 			Name:   "commit.ref",
 			Usage:  "git commit ref",
@@ -49,7 +62,7 @@ func main() {
 		},
 		cli.StringFlag{
 			Name:   "dockerfile",
-			Usage:  "build dockerfile",
+			Usage:  "build dockerfile, an http(s) url or - for stdin",
 			Value:  "Dockerfile",
 			EnvVar: "PLUGIN_DOCKERFILE",
 		},
@@ -76,6 +89,21 @@ func main() {
 			Usage:  "default build tags with suffix",
 			EnvVar: "PLUGIN_DEFAULT_SUFFIX,PLUGIN_AUTO_TAG_SUFFIX",
 		},
+		cli.StringFlag{
+			Name:   "tags.version",
+			Usage:  "semantic version the default build tags are generated from",
+			EnvVar: "PLUGIN_VERSION",
+		},
+		cli.StringFlag{
+			Name:   "tags.file",
+			Usage:  "file with newline separated build tags",
+			EnvVar: "PLUGIN_TAGS_FILE",
+		},
+		cli.BoolFlag{
+			Name:   "tags.sanitize",
+			Usage:  "replace invalid characters in build tags",
+			EnvVar: "PLUGIN_SANITIZE_TAGS",
+		},
 		cli.StringSliceFlag{
 			Name:   "args",
 			Usage:  "build args",
@@ -86,6 +114,16 @@ func main() {
 			Usage:  "build args",
 			EnvVar: "PLUGIN_BUILD_ARGS_FROM_ENV",
 		},
+		cli.StringFlag{
+			Name:   "args-file",
+			Usage:  "build args file",
+			EnvVar: "PLUGIN_BUILD_ARGS_FILE",
+		},
+		cli.StringSliceFlag{
+			Name:   "no-proxy-hosts",
+			Usage:  "hosts added to the no_proxy build args",
+			EnvVar: "PLUGIN_NO_PROXY_HOSTS",
+		},
 		cli.BoolFlag{
 			Name:   "quiet",
 			Usage:  "quiet docker build",
@@ -96,11 +134,31 @@ func main() {
 			Usage:  "build target",
 			EnvVar: "PLUGIN_TARGET",
 		},
+		cli.StringFlag{
+			Name:   "isolation",
+			Usage:  "buildah isolation (oci, rootless or chroot)",
+			EnvVar: "PLUGIN_ISOLATION",
+		},
 		cli.BoolFlag{
 			Name:   "squash",
 			Usage:  "squash the layers at build time",
 			EnvVar: "PLUGIN_SQUASH",
 		},
+		cli.BoolFlag{
+			Name:   "squash-all",
+			Usage:  "squash the layers of the image including the base image",
+			EnvVar: "PLUGIN_SQUASH_ALL",
+		},
+		cli.BoolFlag{
+			Name:   "omit-history",
+			Usage:  "omit the layer history from the image",
+			EnvVar: "PLUGIN_OMIT_HISTORY",
+		},
+		cli.Int64Flag{
+			Name:   "timestamp",
+			Usage:  "build timestamp in unix seconds for reproducible images",
+			EnvVar: "PLUGIN_TIMESTAMP,SOURCE_DATE_EPOCH",
+		},
 		cli.BoolTFlag{
 			Name:   "pull-image",
 			Usage:  "force pull base image at build time",
@@ -111,16 +169,41 @@ func main() {
 			Usage:  "compress the build context using gzip",
 			EnvVar: "PLUGIN_COMPRESS",
 		},
+		cli.StringSliceFlag{
+			Name:   "cache-from",
+			Usage:  "images to consider as cache sources",
+			EnvVar: "PLUGIN_CACHE_FROM",
+		},
+		cli.StringSliceFlag{
+			Name:   "cache-to",
+			Usage:  "repositories the layer cache is pushed to",
+			EnvVar: "PLUGIN_CACHE_TO",
+		},
+		cli.BoolFlag{
+			Name:   "cache-inline",
+			Usage:  "push the layer cache to the image repository and reuse it",
+			EnvVar: "PLUGIN_INLINE_CACHE",
+		},
 		cli.StringFlag{
 			Name:   "repo",
 			Usage:  "docker repository",
 			EnvVar: "PLUGIN_REPO",
 		},
+		cli.StringSliceFlag{
+			Name:   "repos",
+			Usage:  "docker repositories pushed to, overriding repo",
+			EnvVar: "PLUGIN_REPOS",
+		},
 		cli.StringSliceFlag{
 			Name:   "custom-labels",
 			Usage:  "additional k=v labels",
 			EnvVar: "PLUGIN_CUSTOM_LABELS",
 		},
+		cli.StringFlag{
+			Name:   "labels-file",
+			Usage:  "file with key=value build labels",
+			EnvVar: "PLUGIN_LABELS_FILE",
+		},
 		cli.StringSliceFlag{
 			Name:   "label-schema",
 			Usage:  "label-schema labels",
@@ -167,6 +250,11 @@ func main() {
 			Usage:  "docker should cleanup images",
 			EnvVar: "PLUGIN_PURGE",
 		},
+		cli.BoolFlag{
+			Name:   "prune",
+			Usage:  "prune unused images and build cache after the run",
+			EnvVar: "PLUGIN_PRUNE",
+		},
 		cli.StringFlag{
 			Name:   "repo.branch",
 			Usage:  "repository default branch",
@@ -182,6 +270,72 @@ func main() {
 			Usage:  "additional host:IP mapping",
 			EnvVar: "PLUGIN_ADD_HOST",
 		},
+		cli.StringSliceFlag{
+			Name:   "cap-add",
+			Usage:  "capabilities added to the build RUN steps",
+			EnvVar: "PLUGIN_CAP_ADD",
+		},
+		cli.StringSliceFlag{
+			Name:   "cap-drop",
+			Usage:  "capabilities dropped from the build RUN steps",
+			EnvVar: "PLUGIN_CAP_DROP",
+		},
+		cli.StringSliceFlag{
+			Name:   "volumes",
+			Usage:  "volumes mounted into the build RUN steps",
+			EnvVar: "PLUGIN_VOLUMES",
+		},
+		cli.StringFlag{
+			Name:   "memory",
+			Usage:  "build memory limit",
+			EnvVar: "PLUGIN_MEMORY",
+		},
+		cli.StringFlag{
+			Name:   "network",
+			Usage:  "build network (none, host, private, ns:<path> or a network name)",
+			EnvVar: "PLUGIN_NETWORK",
+		},
+		cli.BoolFlag{
+			Name:   "sbom",
+			Usage:  "generate an sbom for the image",
+			EnvVar: "PLUGIN_SBOM",
+		},
+		cli.StringFlag{
+			Name:   "sbom.scanner",
+			Usage:  "sbom scan preset",
+			Value:  "syft-spdx",
+			EnvVar: "PLUGIN_SBOM_SCANNER",
+		},
+		cli.StringFlag{
+			Name:   "sbom.output",
+			Usage:  "write the sbom to a file",
+			EnvVar: "PLUGIN_SBOM_OUTPUT",
+		},
+		cli.BoolFlag{
+			Name:   "sign",
+			Usage:  "sign the pushed tags with cosign",
+			EnvVar: "PLUGIN_SIGN",
+		},
+		cli.StringFlag{
+			Name:   "cosign.key",
+			Usage:  "cosign private key",
+			EnvVar: "PLUGIN_COSIGN_KEY",
+		},
+		cli.StringFlag{
+			Name:   "cosign.password",
+			Usage:  "cosign private key password",
+			EnvVar: "PLUGIN_COSIGN_PASSWORD",
+		},
+		cli.Int64Flag{
+			Name:   "cpu-shares",
+			Usage:  "build cpu shares",
+			EnvVar: "PLUGIN_CPU_SHARES",
+		},
+		cli.Int64Flag{
+			Name:   "cpu-quota",
+			Usage:  "build cpu quota in microseconds per period",
+			EnvVar: "PLUGIN_CPU_QUOTA",
+		},
 		cli.StringFlag{
 			Name:   "s3-local-cache-dir",
 			Usage:  "local directory for S3 based cache",
@@ -222,6 +376,515 @@ func main() {
 			Usage:  "User Layers",
 			EnvVar: "PLUGIN_LAYERS",
 		},
+		cli.BoolFlag{
+			Name:   "lint",
+			Usage:  "lint the dockerfile before building",
+			EnvVar: "PLUGIN_LINT",
+		},
+		cli.StringFlag{
+			Name:   "linter",
+			Usage:  "dockerfile linter (builtin, hadolint or a command)",
+			EnvVar: "PLUGIN_LINTER",
+		},
+		cli.BoolFlag{
+			Name:   "add-history",
+			Usage:  "add history entries to the image (unset uses the buildah default)",
+			EnvVar: "PLUGIN_ADD_HISTORY",
+		},
+		cli.StringFlag{
+			Name:   "cgroup-manager",
+			Usage:  "buildah cgroup manager (cgroupfs or systemd)",
+			EnvVar: "PLUGIN_CGROUP_MANAGER",
+		},
+		cli.StringFlag{
+			Name:   "slack-webhook",
+			Usage:  "slack webhook notified after the build",
+			EnvVar: "PLUGIN_SLACK_WEBHOOK",
+		},
+		cli.StringFlag{
+			Name:   "squash-if-larger-than",
+			Usage:  "squash the image when larger than this size, e.g. 500m",
+			EnvVar: "PLUGIN_SQUASH_IF_LARGER_THAN",
+		},
+		cli.StringFlag{
+			Name:   "commit-author",
+			Usage:  "author recorded on images committed by the plugin",
+			EnvVar: "PLUGIN_COMMIT_AUTHOR,DRONE_COMMIT_AUTHOR",
+		},
+		cli.StringFlag{
+			Name:   "commit-message",
+			Usage:  "message recorded on images committed by the plugin",
+			EnvVar: "PLUGIN_COMMIT_MESSAGE,DRONE_COMMIT_MESSAGE",
+		},
+		cli.BoolFlag{
+			Name:   "cache-from.parallel",
+			Usage:  "pull cache-from images concurrently",
+			EnvVar: "PLUGIN_PARALLEL_CACHE_PULL",
+		},
+		cli.IntFlag{
+			Name:   "max-concurrency",
+			Usage:  "maximum number of concurrent operations",
+			EnvVar: "PLUGIN_MAX_CONCURRENCY",
+		},
+		cli.StringFlag{
+			Name:   "config-home",
+			Usage:  "base directory for the containers configuration (defaults to $HOME)",
+			EnvVar: "PLUGIN_CONFIG_HOME",
+		},
+		cli.BoolFlag{
+			Name:   "context.report-size",
+			Usage:  "log the build context size before building",
+			EnvVar: "PLUGIN_REPORT_CONTEXT_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "context.warn-size",
+			Usage:  "warn when the build context exceeds this size, e.g. 100m",
+			EnvVar: "PLUGIN_CONTEXT_SIZE_WARN",
+		},
+		cli.StringFlag{
+			Name:   "seccomp-profile",
+			Usage:  "seccomp profile applied to RUN instructions",
+			EnvVar: "PLUGIN_SECCOMP_PROFILE",
+		},
+		cli.BoolFlag{
+			Name:   "tags.sha",
+			Usage:  "tag the image with the short commit sha",
+			EnvVar: "PLUGIN_TAG_WITH_SHA",
+		},
+		cli.IntFlag{
+			Name:   "tags.sha-length",
+			Usage:  "length of the short commit sha tag",
+			EnvVar: "PLUGIN_SHA_LENGTH",
+			Value:  7,
+		},
+		cli.BoolFlag{
+			Name:   "keep-stages",
+			Usage:  "keep intermediate stage containers and images for debugging",
+			EnvVar: "PLUGIN_KEEP_STAGES",
+		},
+		cli.StringFlag{
+			Name:   "max-image-size",
+			Usage:  "fail when the image is larger than this size, e.g. 250m",
+			EnvVar: "PLUGIN_MAX_IMAGE_SIZE",
+		},
+		cli.StringSliceFlag{
+			Name:   "inherit-labels",
+			Usage:  "label keys copied from the base image",
+			EnvVar: "PLUGIN_INHERIT_LABELS",
+		},
+		cli.StringFlag{
+			Name:   "staging-tag",
+			Usage:  "tag pushed and verified before the final tags",
+			EnvVar: "PLUGIN_STAGING_TAG",
+		},
+		cli.StringSliceFlag{
+			Name:   "verify-command",
+			Usage:  "command verifying the staging image",
+			EnvVar: "PLUGIN_VERIFY_COMMAND",
+		},
+		cli.BoolFlag{
+			Name:   "staging-cleanup",
+			Usage:  "delete the staging tag when verification fails",
+			EnvVar: "PLUGIN_STAGING_CLEANUP",
+		},
+		cli.BoolFlag{
+			Name:   "rate-limit.retry",
+			Usage:  "wait and retry pulls rejected by registry rate limits",
+			EnvVar: "PLUGIN_HANDLE_RATE_LIMITS",
+		},
+		cli.DurationFlag{
+			Name:   "rate-limit.max-wait",
+			Usage:  "maximum time spent waiting on registry rate limits",
+			EnvVar: "PLUGIN_RATE_LIMIT_MAX_WAIT",
+			Value:  5 * time.Minute,
+		},
+		cli.StringFlag{
+			Name:   "build-hostname",
+			Usage:  "hostname of the build container",
+			EnvVar: "PLUGIN_BUILD_HOSTNAME",
+		},
+		cli.StringFlag{
+			Name:   "assert-entrypoint",
+			Usage:  "expected image entrypoint, as a JSON array or words",
+			EnvVar: "PLUGIN_ASSERT_ENTRYPOINT",
+		},
+		cli.StringSliceFlag{
+			Name:   "assert-cmd",
+			Usage:  "expected image cmd",
+			EnvVar: "PLUGIN_ASSERT_CMD",
+		},
+		cli.StringFlag{
+			Name:   "variants",
+			Usage:  "json list of build variants with a tag and args",
+			EnvVar: "PLUGIN_VARIANTS",
+		},
+		cli.StringFlag{
+			Name:   "target-map",
+			Usage:  "json map of build targets to the repos they are pushed to",
+			EnvVar: "PLUGIN_TARGET_MAP",
+		},
+		cli.StringFlag{
+			Name:   "storage-driver",
+			Usage:  "buildah storage driver",
+			EnvVar: "PLUGIN_STORAGE_DRIVER",
+		},
+		cli.StringFlag{
+			Name:   "mount-program",
+			Usage:  "overlay mount program, e.g. /usr/bin/fuse-overlayfs",
+			EnvVar: "PLUGIN_MOUNT_PROGRAM",
+		},
+		cli.StringFlag{
+			Name:   "storage-graphroot",
+			Usage:  "buildah storage graph root, e.g. a mounted cache volume",
+			EnvVar: "PLUGIN_STORAGE_GRAPHROOT",
+		},
+		cli.StringFlag{
+			Name:   "storage-runroot",
+			Usage:  "buildah storage run root",
+			EnvVar: "PLUGIN_STORAGE_RUNROOT",
+		},
+		cli.BoolFlag{
+			Name:   "storage.build-only",
+			Usage:  "apply the storage config only to the build, pulling with the host default storage",
+			EnvVar: "PLUGIN_BUILD_ONLY_STORAGE",
+		},
+		cli.StringSliceFlag{
+			Name:   "warm-contexts",
+			Usage:  "contexts (context[:dockerfile]) built only to warm the layer cache",
+			EnvVar: "PLUGIN_WARM_CONTEXTS",
+		},
+		cli.BoolFlag{
+			Name:   "warm-contexts.continue-on-error",
+			Usage:  "ignore failures building warm contexts",
+			EnvVar: "PLUGIN_WARM_CONTINUE_ON_ERROR",
+		},
+		cli.StringFlag{
+			Name:   "stop-signal",
+			Usage:  "image stop signal",
+			EnvVar: "PLUGIN_STOP_SIGNAL",
+		},
+		cli.StringFlag{
+			Name:   "healthcheck",
+			Usage:  "image healthcheck command, e.g. CMD curl -f http://localhost/",
+			EnvVar: "PLUGIN_HEALTHCHECK",
+		},
+		cli.StringFlag{
+			Name:   "healthcheck.interval",
+			Usage:  "image healthcheck interval",
+			EnvVar: "PLUGIN_HEALTHCHECK_INTERVAL",
+		},
+		cli.StringFlag{
+			Name:   "healthcheck.timeout",
+			Usage:  "image healthcheck timeout",
+			EnvVar: "PLUGIN_HEALTHCHECK_TIMEOUT",
+		},
+		cli.StringFlag{
+			Name:   "healthcheck.start-period",
+			Usage:  "image healthcheck start period",
+			EnvVar: "PLUGIN_HEALTHCHECK_START_PERIOD",
+		},
+		cli.IntFlag{
+			Name:   "healthcheck.retries",
+			Usage:  "image healthcheck retries",
+			EnvVar: "PLUGIN_HEALTHCHECK_RETRIES",
+		},
+		cli.StringSliceFlag{
+			Name:   "smoke-test",
+			Usage:  "command run inside the built image before pushing",
+			EnvVar: "PLUGIN_SMOKE_TEST",
+		},
+		cli.StringFlag{
+			Name:   "min-buildah-version",
+			Usage:  "minimum buildah version required",
+			EnvVar: "PLUGIN_MIN_BUILDAH_VERSION",
+		},
+		cli.StringFlag{
+			Name:   "tag-args",
+			Usage:  "build args applied only to specific tags in json format",
+			EnvVar: "PLUGIN_TAG_ARGS",
+		},
+		cli.StringFlag{
+			Name:   "annotations-file",
+			Usage:  "write the image labels and annotations to a json file",
+			EnvVar: "PLUGIN_ANNOTATIONS_FILE",
+		},
+		cli.StringFlag{
+			Name:   "base-lock-file",
+			Usage:  "write the digests of the base images to a json file",
+			EnvVar: "PLUGIN_BASE_LOCK_FILE",
+		},
+		cli.StringSliceFlag{
+			Name:   "rebuild-stages",
+			Usage:  "build stages rebuilt without the layer cache",
+			EnvVar: "PLUGIN_REBUILD_STAGES",
+		},
+		cli.StringFlag{
+			Name:   "mirror.registry",
+			Usage:  "mirror registry the pushed tags are copied to",
+			EnvVar: "PLUGIN_MIRROR_REGISTRY",
+		},
+		cli.StringFlag{
+			Name:   "mirror.username",
+			Usage:  "mirror registry username",
+			EnvVar: "PLUGIN_MIRROR_USERNAME",
+		},
+		cli.StringFlag{
+			Name:   "mirror.password",
+			Usage:  "mirror registry password",
+			EnvVar: "PLUGIN_MIRROR_PASSWORD",
+		},
+		cli.BoolFlag{
+			Name:   "mirror.async",
+			Usage:  "push to the mirror without failing the build",
+			EnvVar: "PLUGIN_MIRROR_ASYNC",
+		},
+		cli.StringFlag{
+			Name:   "cache-registry.creds",
+			Usage:  "cache-from registry credentials in user:pass format",
+			EnvVar: "PLUGIN_CACHE_REGISTRY_CREDS",
+		},
+		cli.BoolFlag{
+			Name:   "build-info.label",
+			Usage:  "stamp the sanitized build configuration as a label",
+			EnvVar: "PLUGIN_BUILD_INFO_LABEL",
+		},
+		cli.StringFlag{
+			Name:   "build-info.label-key",
+			Usage:  "label key the build configuration is stamped under",
+			Value:  "io.drone.build-info",
+			EnvVar: "PLUGIN_BUILD_INFO_LABEL_KEY",
+		},
+		cli.StringFlag{
+			Name:   "pull-policy",
+			Usage:  "base image pull policy (always, missing, never or newer)",
+			EnvVar: "PLUGIN_PULL_POLICY",
+		},
+		cli.DurationFlag{
+			Name:   "timeout",
+			Usage:  "maximum duration of the plugin run",
+			EnvVar: "PLUGIN_TIMEOUT",
+		},
+		cli.BoolFlag{
+			Name:   "load-to-docker",
+			Usage:  "load the built image into the local docker daemon",
+			EnvVar: "PLUGIN_LOAD_TO_DOCKER",
+		},
+		cli.StringFlag{
+			Name:   "stage-args",
+			Usage:  "build args for named stages in json format",
+			EnvVar: "PLUGIN_STAGE_ARGS",
+		},
+		cli.BoolFlag{
+			Name:   "cache-stats",
+			Usage:  "log the build cache hits and misses",
+			EnvVar: "PLUGIN_CACHE_STATS",
+		},
+		cli.BoolFlag{
+			Name:   "force-push",
+			Usage:  "delete protected tags from the registry before pushing, by digest, which also deletes other tags of the same image",
+			EnvVar: "PLUGIN_FORCE_PUSH",
+		},
+		cli.StringSliceFlag{
+			Name:   "force-push.tags",
+			Usage:  "tags confirmed for force push",
+			EnvVar: "PLUGIN_FORCE_PUSH_TAGS",
+		},
+		cli.BoolFlag{
+			Name:   "manifest.auto-annotate",
+			Usage:  "annotate the manifest list with the git metadata",
+			EnvVar: "PLUGIN_MANIFEST_AUTO_ANNOTATE",
+		},
+		cli.BoolTFlag{
+			Name:   "clean-auth",
+			Usage:  "remove the login credentials after the run",
+			EnvVar: "PLUGIN_CLEAN_AUTH",
+		},
+		cli.StringFlag{
+			Name:   "digest-file",
+			Usage:  "write the tag to digest references to a json file",
+			EnvVar: "PLUGIN_DIGEST_FILE",
+		},
+		cli.BoolFlag{
+			Name:   "digest-only",
+			Usage:  "push by digest only, recording the tags in the digest file",
+			EnvVar: "PLUGIN_DIGEST_ONLY",
+		},
+		cli.BoolFlag{
+			Name:   "require-pinned-base",
+			Usage:  "fail for base images not pinned by digest",
+			EnvVar: "PLUGIN_REQUIRE_PINNED_BASE",
+		},
+		cli.StringSliceFlag{
+			Name:   "pinned-base.allowlist",
+			Usage:  "base images allowed without a digest pin",
+			EnvVar: "PLUGIN_PINNED_BASE_ALLOWLIST",
+		},
+		cli.IntFlag{
+			Name:   "nice",
+			Usage:  "nice value of the build and push commands",
+			EnvVar: "PLUGIN_NICE",
+		},
+		cli.StringFlag{
+			Name:   "ionice",
+			Usage:  "io priority of the build and push commands (class[:level])",
+			EnvVar: "PLUGIN_IONICE",
+		},
+		cli.StringFlag{
+			Name:   "deploy-snippet.file",
+			Usage:  "write a digest pinned yaml snippet to a file",
+			EnvVar: "PLUGIN_DEPLOY_SNIPPET_FILE",
+		},
+		cli.StringFlag{
+			Name:   "deploy-snippet.key",
+			Usage:  "yaml key the deploy snippet is written under",
+			EnvVar: "PLUGIN_DEPLOY_SNIPPET_KEY",
+		},
+		cli.BoolTFlag{
+			Name:   "verbose",
+			Usage:  "stream the buildah version and info to the logs",
+			EnvVar: "PLUGIN_VERBOSE",
+		},
+		cli.StringSliceFlag{
+			Name:   "platforms",
+			Usage:  "build target platforms, building a manifest list for more than one",
+			EnvVar: "PLUGIN_PLATFORMS",
+		},
+		cli.BoolFlag{
+			Name:   "capture.stdout",
+			Usage:  "capture the command output instead of streaming it",
+			EnvVar: "PLUGIN_CAPTURE_STDOUT",
+		},
+		cli.BoolFlag{
+			Name:   "capture.stderr",
+			Usage:  "capture the command errors instead of streaming them",
+			EnvVar: "PLUGIN_CAPTURE_STDERR",
+		},
+		cli.StringFlag{
+			Name:   "capture.stdout-file",
+			Usage:  "file the captured output is written to",
+			EnvVar: "PLUGIN_CAPTURE_STDOUT_FILE",
+		},
+		cli.StringFlag{
+			Name:   "capture.stderr-file",
+			Usage:  "file the captured errors are written to",
+			EnvVar: "PLUGIN_CAPTURE_STDERR_FILE",
+		},
+		cli.StringFlag{
+			Name:   "post-commands",
+			Usage:  "commands run after all pushes succeed in json format",
+			EnvVar: "PLUGIN_POST_COMMANDS",
+		},
+		cli.BoolFlag{
+			Name:   "post-commands.continue-on-error",
+			Usage:  "ignore post command failures",
+			EnvVar: "PLUGIN_POST_COMMANDS_CONTINUE_ON_ERROR",
+		},
+		cli.StringSliceFlag{
+			Name:   "required-args",
+			Usage:  "build args that must be set",
+			EnvVar: "PLUGIN_REQUIRED_ARGS",
+		},
+		cli.BoolFlag{
+			Name:   "require-declared-args",
+			Usage:  "fail for declared build args without a default that are not set",
+			EnvVar: "PLUGIN_REQUIRE_DECLARED_ARGS",
+		},
+		cli.IntFlag{
+			Name:   "build.number",
+			Usage:  "drone build number",
+			EnvVar: "DRONE_BUILD_NUMBER",
+		},
+		cli.StringSliceFlag{
+			Name:   "tags.template",
+			Usage:  "tags rendered from go templates ({{.Branch}}, {{.SHA}}, {{.ShortSHA}}, {{.Tag}}, {{.BuildNumber}}, {{.Date}})",
+			EnvVar: "PLUGIN_TAG_TEMPLATES",
+		},
+		cli.BoolFlag{
+			Name:   "create-repo",
+			Usage:  "create the registry repository before the first push (harbor)",
+			EnvVar: "PLUGIN_CREATE_REPO",
+		},
+		cli.BoolFlag{
+			Name:   "attach-logs",
+			Usage:  "attach the build log to the pushed image as an oci referrer (buildah 1.32+, registry with oci 1.1 referrers)",
+			EnvVar: "PLUGIN_ATTACH_LOGS",
+		},
+		cli.DurationFlag{
+			Name:   "command-timeout",
+			Usage:  "maximum duration of each command, e.g. 10m",
+			EnvVar: "PLUGIN_COMMAND_TIMEOUT",
+		},
+		cli.IntFlag{
+			Name:   "push.retries",
+			Usage:  "number of times a failed push is retried",
+			EnvVar: "PLUGIN_PUSH_RETRIES",
+		},
+		cli.DurationFlag{
+			Name:   "push.retry-delay",
+			Usage:  "delay between push attempts",
+			Value:  10 * time.Second,
+			EnvVar: "PLUGIN_PUSH_RETRY_DELAY",
+		},
+		cli.BoolFlag{
+			Name:   "push.ignore-errors",
+			Usage:  "ignore push failures",
+			EnvVar: "PLUGIN_IGNORE_PUSH_ERRORS",
+		},
+		cli.IntFlag{
+			Name:   "retry-budget",
+			Usage:  "maximum number of retries across the run",
+			EnvVar: "PLUGIN_RETRY_BUDGET",
+		},
+		cli.StringFlag{
+			Name:   "verify-image",
+			Usage:  "pull and verify an existing image instead of building",
+			EnvVar: "PLUGIN_VERIFY_IMAGE",
+		},
+		cli.BoolFlag{
+			Name:   "logout",
+			Usage:  "log out of the registries after the run",
+			EnvVar: "PLUGIN_LOGOUT",
+		},
+		cli.BoolFlag{
+			Name:   "tls-verify",
+			Usage:  "verify registry tls certificates for login, push and pull (unset uses the buildah default)",
+			EnvVar: "PLUGIN_TLS_VERIFY",
+		},
+		cli.BoolFlag{
+			Name:   "github-output",
+			Usage:  "write the image, digest and tags to the github actions output file",
+			EnvVar: "PLUGIN_GITHUB_OUTPUT",
+		},
+		cli.StringFlag{
+			Name:   "max-graphroot-size",
+			Usage:  "abort the build when the storage graphroot exceeds this size, e.g. 20GB",
+			EnvVar: "PLUGIN_MAX_GRAPHROOT_SIZE",
+		},
+		cli.StringFlag{
+			Name:   "output-file",
+			Usage:  "write the build metadata to this file as json",
+			EnvVar: "PLUGIN_OUTPUT_FILE",
+		},
+		cli.StringFlag{
+			Name:   "cache-to.template",
+			Usage:  "repository the layer cache is pushed to, rendered like the tag templates (requires layers)",
+			EnvVar: "PLUGIN_CACHE_TO_TEMPLATE",
+		},
+		cli.StringSliceFlag{
+			Name:   "command-prefix",
+			Usage:  "wrapper buildah commands are run through, e.g. sudo,-n",
+			EnvVar: "PLUGIN_COMMAND_PREFIX",
+		},
+		cli.StringSliceFlag{
+			Name:   "ssh",
+			Usage:  "ssh agent sockets or keys exposed to RUN --mount=type=ssh (id[=path])",
+			EnvVar: "PLUGIN_SSH",
+		},
+		cli.BoolFlag{
+			Name:   "ssh.default",
+			Usage:  "forward the host ssh agent at SSH_AUTH_SOCK",
+			EnvVar: "PLUGIN_SSH_DEFAULT",
+		},
 	}
 
 	if err := app.Run(os.Args); err != nil {
@@ -230,49 +893,221 @@ func main() {
 }
 
 func run(c *cli.Context) error {
+	var variants []docker.Variant
+	if s := c.String("variants"); s != "" {
+		if err := json.Unmarshal([]byte(s), &variants); err != nil {
+			return fmt.Errorf("Error parsing variants: %s", err)
+		}
+	}
+
+	var tagArgs map[string][]string
+	if s := c.String("tag-args"); s != "" {
+		if err := json.Unmarshal([]byte(s), &tagArgs); err != nil {
+			return fmt.Errorf("Error parsing tag args: %s", err)
+		}
+	}
+
+	var targetMap map[string]string
+	if s := c.String("target-map"); s != "" {
+		if err := json.Unmarshal([]byte(s), &targetMap); err != nil {
+			return fmt.Errorf("Error parsing target map: %s", err)
+		}
+	}
+
+	var stageArgs map[string][]string
+	if s := c.String("stage-args"); s != "" {
+		if err := json.Unmarshal([]byte(s), &stageArgs); err != nil {
+			return fmt.Errorf("Error parsing stage args: %s", err)
+		}
+	}
+
+	var postCommands [][]string
+	if s := c.String("post-commands"); s != "" {
+		if err := json.Unmarshal([]byte(s), &postCommands); err != nil {
+			return fmt.Errorf("Error parsing post commands: %s", err)
+		}
+	}
+
 	plugin := docker.Plugin{
-		Dryrun:  c.Bool("dry-run"),
-		Cleanup: c.BoolT("docker.purge"),
+		Dryrun:            c.Bool("dry-run"),
+		Preview:           c.Bool("preview"),
+		Cleanup:           c.BoolT("docker.purge"),
+		Prune:             c.Bool("prune"),
+		SlackWebhook:      c.String("slack-webhook"),
+		MaxConcurrency:    c.Int("max-concurrency"),
+		ConfigHome:        c.String("config-home"),
+		HandleRateLimits:  c.Bool("rate-limit.retry"),
+		RetryBudget:       c.Int("retry-budget"),
+		RateLimitMaxWait:  c.Duration("rate-limit.max-wait"),
+		MinBuildahVersion: c.String("min-buildah-version"),
+		MirrorAsync:       c.Bool("mirror.async"),
+		Timeout:           c.Duration("timeout"),
+		CleanAuth:         c.BoolT("clean-auth"),
+		Verbose:           c.BoolT("verbose"),
+		CaptureStdout:     c.Bool("capture.stdout"),
+		CaptureStderr:     c.Bool("capture.stderr"),
+		StdoutFile:        c.String("capture.stdout-file"),
+		StderrFile:        c.String("capture.stderr-file"),
+		Logout:            c.Bool("logout"),
+		GithubOutput:      c.Bool("github-output"),
+		OutputFile:        c.String("output-file"),
 		Login: docker.Login{
-			Registry: c.String("docker.registry"),
-			Username: c.String("docker.username"),
-			Password: c.String("docker.password"),
-			Email:    c.String("docker.email"),
-			Config:   c.String("docker.config"),
+			Registry:  c.String("docker.registry"),
+			Username:  c.String("docker.username"),
+			Password:  c.String("docker.password"),
+			Email:     c.String("docker.email"),
+			Config:    c.String("docker.config"),
+			TLSVerify: optionalBool(c, "tls-verify"),
+		},
+		Mirror: docker.Login{
+			Registry: c.String("mirror.registry"),
+			Username: c.String("mirror.username"),
+			Password: c.String("mirror.password"),
 		},
 		Build: docker.Build{
-			Remote:      c.String("remote.url"),
-			Name:        c.String("commit.sha"),
-			Dockerfile:  c.String("dockerfile"),
-			Context:     c.String("context"),
-			Tags:        c.StringSlice("tags"),
-			Args:        c.StringSlice("args"),
-			ArgsEnv:     c.StringSlice("args-from-env"),
-			Target:      c.String("target"),
-			Squash:      c.Bool("squash"),
-			Pull:        c.BoolT("pull-image"),
-			CacheFrom:   c.StringSlice("cache-from"),
-			Compress:    c.Bool("compress"),
-			Repo:        c.String("repo"),
-			Labels:      c.StringSlice("custom-labels"),
-			LabelSchema: c.StringSlice("label-schema"),
-			AutoLabel:   c.BoolT("auto-label"),
-			Link:        c.String("link"),
-			NoCache:     c.Bool("no-cache"),
-			AddHost:     c.StringSlice("add-host"),
-			Quiet:       c.Bool("quiet"),
-			S3CacheDir:  c.String("s3-local-cache-dir"),
-			S3Bucket:    c.String("s3-bucket"),
-			S3Endpoint:  c.String("s3-endpoint"),
-			S3Region:    c.String("s3-region"),
-			S3Key:       c.String("s3-key"),
-			S3Secret:    c.String("s3-secret"),
-			S3UseSSL:    c.Bool("s3-use-ssl"),
-			Layers:      c.Bool("layers"),
+			Remote:                      c.String("remote.url"),
+			Name:                        c.String("commit.sha"),
+			Dockerfile:                  c.String("dockerfile"),
+			Context:                     c.String("context"),
+			Tags:                        c.StringSlice("tags"),
+			AutoTag:                     c.Bool("tags.auto"),
+			AutoTagSuffix:               c.String("tags.suffix"),
+			Version:                     c.String("tags.version"),
+			Args:                        c.StringSlice("args"),
+			ArgsEnv:                     c.StringSlice("args-from-env"),
+			ArgsFile:                    c.String("args-file"),
+			NoProxyHosts:                c.StringSlice("no-proxy-hosts"),
+			Target:                      c.String("target"),
+			Isolation:                   c.String("isolation"),
+			Squash:                      c.Bool("squash"),
+			SquashAll:                   c.Bool("squash-all"),
+			OmitHistory:                 c.Bool("omit-history"),
+			Timestamp:                   c.Int64("timestamp"),
+			Pull:                        c.BoolT("pull-image"),
+			CacheFrom:                   c.StringSlice("cache-from"),
+			CacheTo:                     c.StringSlice("cache-to"),
+			InlineCache:                 c.Bool("cache-inline"),
+			Compress:                    c.Bool("compress"),
+			Repo:                        c.String("repo"),
+			Repos:                       c.StringSlice("repos"),
+			Labels:                      c.StringSlice("custom-labels"),
+			LabelsFile:                  c.String("labels-file"),
+			LabelSchema:                 c.StringSlice("label-schema"),
+			AutoLabel:                   c.BoolT("auto-label"),
+			Link:                        c.String("link"),
+			Branch:                      c.String("commit.branch"),
+			NoCache:                     c.Bool("no-cache"),
+			AddHost:                     c.StringSlice("add-host"),
+			CapAdd:                      c.StringSlice("cap-add"),
+			CapDrop:                     c.StringSlice("cap-drop"),
+			Volumes:                     c.StringSlice("volumes"),
+			Memory:                      c.String("memory"),
+			Network:                     c.String("network"),
+			SBOM:                        c.Bool("sbom"),
+			SBOMScanner:                 c.String("sbom.scanner"),
+			SBOMOutput:                  c.String("sbom.output"),
+			Sign:                        c.Bool("sign"),
+			CosignKey:                   c.String("cosign.key"),
+			CosignPassword:              c.String("cosign.password"),
+			CPUShares:                   c.Int64("cpu-shares"),
+			CPUQuota:                    c.Int64("cpu-quota"),
+			Quiet:                       c.Bool("quiet"),
+			S3CacheDir:                  c.String("s3-local-cache-dir"),
+			S3Bucket:                    c.String("s3-bucket"),
+			S3Endpoint:                  c.String("s3-endpoint"),
+			S3Region:                    c.String("s3-region"),
+			S3Key:                       c.String("s3-key"),
+			S3Secret:                    c.String("s3-secret"),
+			S3UseSSL:                    c.Bool("s3-use-ssl"),
+			Layers:                      c.Bool("layers"),
+			Lint:                        c.Bool("lint"),
+			Linter:                      c.String("linter"),
+			AddHistory:                  optionalBool(c, "add-history"),
+			TagsFile:                    c.String("tags.file"),
+			SanitizeTags:                c.Bool("tags.sanitize"),
+			CgroupManager:               c.String("cgroup-manager"),
+			SquashIfLargerThan:          c.String("squash-if-larger-than"),
+			CommitAuthor:                c.String("commit-author"),
+			CommitMessage:               c.String("commit-message"),
+			ParallelCachePull:           c.Bool("cache-from.parallel"),
+			ReportContextSize:           c.Bool("context.report-size"),
+			ContextSizeWarn:             c.String("context.warn-size"),
+			SeccompProfile:              c.String("seccomp-profile"),
+			TagWithSHA:                  c.Bool("tags.sha"),
+			SHALength:                   c.Int("tags.sha-length"),
+			KeepStages:                  c.Bool("keep-stages"),
+			MaxImageSize:                c.String("max-image-size"),
+			InheritLabels:               c.StringSlice("inherit-labels"),
+			StagingTag:                  c.String("staging-tag"),
+			VerifyCommand:               c.StringSlice("verify-command"),
+			StagingCleanup:              c.Bool("staging-cleanup"),
+			BuildHostname:               c.String("build-hostname"),
+			AssertEntrypoint:            c.String("assert-entrypoint"),
+			AssertCmd:                   c.StringSlice("assert-cmd"),
+			Variants:                    variants,
+			TargetMap:                   targetMap,
+			StorageDriver:               c.String("storage-driver"),
+			MountProgram:                c.String("mount-program"),
+			GraphRoot:                   c.String("storage-graphroot"),
+			RunRoot:                     c.String("storage-runroot"),
+			BuildOnlyStorage:            c.Bool("storage.build-only"),
+			WarmContexts:                c.StringSlice("warm-contexts"),
+			WarmContinueOnError:         c.Bool("warm-contexts.continue-on-error"),
+			StopSignal:                  c.String("stop-signal"),
+			Healthcheck:                 c.String("healthcheck"),
+			HealthcheckInterval:         c.String("healthcheck.interval"),
+			HealthcheckTimeout:          c.String("healthcheck.timeout"),
+			HealthcheckStartPeriod:      c.String("healthcheck.start-period"),
+			HealthcheckRetries:          c.Int("healthcheck.retries"),
+			SmokeTest:                   c.StringSlice("smoke-test"),
+			TagArgs:                     tagArgs,
+			AnnotationsFile:             c.String("annotations-file"),
+			BaseLockFile:                c.String("base-lock-file"),
+			RebuildStages:               c.StringSlice("rebuild-stages"),
+			CacheRegistryCreds:          c.String("cache-registry.creds"),
+			BuildInfoLabel:              c.Bool("build-info.label"),
+			BuildInfoLabelKey:           c.String("build-info.label-key"),
+			BasePullPolicy:              c.String("pull-policy"),
+			LoadToDocker:                c.Bool("load-to-docker"),
+			StageArgs:                   stageArgs,
+			ReportCacheStats:            c.Bool("cache-stats"),
+			ForcePush:                   c.Bool("force-push"),
+			ForcePushTags:               c.StringSlice("force-push.tags"),
+			ManifestAutoAnnotate:        c.Bool("manifest.auto-annotate"),
+			DigestFile:                  c.String("digest-file"),
+			DigestOnly:                  c.Bool("digest-only"),
+			RequirePinnedBase:           c.Bool("require-pinned-base"),
+			PinnedBaseAllowlist:         c.StringSlice("pinned-base.allowlist"),
+			Nice:                        c.Int("nice"),
+			IONice:                      c.String("ionice"),
+			DeploySnippetFile:           c.String("deploy-snippet.file"),
+			DeploySnippetKey:            c.String("deploy-snippet.key"),
+			Platforms:                   c.StringSlice("platforms"),
+			PostCommands:                postCommands,
+			PostCommandsContinueOnError: c.Bool("post-commands.continue-on-error"),
+			RequiredArgs:                c.StringSlice("required-args"),
+			RequireDeclaredArgs:         c.Bool("require-declared-args"),
+			Ref:                         c.String("commit.ref"),
+			BuildNumber:                 c.Int("build.number"),
+			TagTemplates:                c.StringSlice("tags.template"),
+			CreateRepo:                  c.Bool("create-repo"),
+			AttachLogs:                  c.Bool("attach-logs"),
+			CommandTimeout:              c.Duration("command-timeout"),
+			PushRetries:                 c.Int("push.retries"),
+			PushRetryDelay:              c.Duration("push.retry-delay"),
+			IgnorePushErrors:            c.Bool("push.ignore-errors"),
+			VerifyImage:                 c.String("verify-image"),
+			TLSVerify:                   optionalBool(c, "tls-verify"),
+			MaxGraphrootSize:            c.String("max-graphroot-size"),
+			CacheToTemplate:             c.String("cache-to.template"),
+			CommandPrefix:               c.StringSlice("command-prefix"),
+			SSHAgents:                   c.StringSlice("ssh"),
+			SSHDefault:                  c.Bool("ssh.default"),
 		},
 	}
 
-	if c.Bool("tags.auto") {
+	// without a version the default tags are generated from the commit ref
+	if c.Bool("tags.auto") && c.String("tags.version") == "" {
 		if docker.UseDefaultTag( // return true if tag event or default branch
 			c.String("commit.ref"),
 			c.String("repo.branch"),
@@ -294,3 +1129,12 @@ func run(c *cli.Context) error {
 
 	return plugin.Exec()
 }
+
+// helper function to read a boolean flag that is nil when unset.
+func optionalBool(c *cli.Context, name string) *bool {
+	if !c.IsSet(name) {
+		return nil
+	}
+	value := c.Bool(name)
+	return &value
+}
@@ -0,0 +1,165 @@
+package docker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// helper function to squash the built image when its size exceeds
+// the configured threshold.
+func (p Plugin) squashIfLarger() error {
+	limit, err := parseSize(p.Build.SquashIfLargerThan)
+	if err != nil {
+		return err
+	}
+	info, err := p.inspect(p.Build.Name)
+	if err != nil {
+		return err
+	}
+	size, err := info.size()
+	if err != nil {
+		return err
+	}
+
+	if size <= limit {
+		fmt.Printf("Image size %s does not exceed %s. Skipping squash\n", formatSize(size), formatSize(limit))
+		return nil
+	}
+	fmt.Printf("Image size %s exceeds %s. Squashing image\n", formatSize(size), formatSize(limit))
+	return p.recommit(nil, true)
+}
+
+// helper function to copy the configured labels from the base image
+// to the built image, skipping labels the base image does not define.
+func (p Plugin) inheritLabels() error {
+	list, err := readDockerfile(p.Build.Dockerfile)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", p.Build.Dockerfile, err)
+	}
+	base := baseImage(parseStages(list, p.Build.Args), p.Build.Target)
+	if base == "" || base == "scratch" {
+		fmt.Println("Could not determine the base image. Skipping label inheritance...")
+		return nil
+	}
+
+	info, err := p.inspect(base)
+	if err != nil {
+		return err
+	}
+	var config []string
+	for _, key := range p.Build.InheritLabels {
+		value, ok := info.OCIv1.Config.Labels[key]
+		if !ok {
+			fmt.Printf("Base image %s has no label %s. Skipping...\n", base, key)
+			continue
+		}
+		config = append(config, "--label", fmt.Sprintf("%s=%s", key, value))
+	}
+	if len(config) == 0 {
+		return nil
+	}
+	return p.recommit(config, false)
+}
+
+// helper function to create the config arguments setting the stop
+// signal and healthcheck of the image.
+func runtimeConfig(build Build) []string {
+	var args []string
+	if build.StopSignal != "" {
+		args = append(args, "--stop-signal", build.StopSignal)
+	}
+	if build.Healthcheck != "" {
+		args = append(args, "--healthcheck", build.Healthcheck)
+		if build.HealthcheckInterval != "" {
+			args = append(args, "--healthcheck-interval", build.HealthcheckInterval)
+		}
+		if build.HealthcheckTimeout != "" {
+			args = append(args, "--healthcheck-timeout", build.HealthcheckTimeout)
+		}
+		if build.HealthcheckStartPeriod != "" {
+			args = append(args, "--healthcheck-start-period", build.HealthcheckStartPeriod)
+		}
+		if build.HealthcheckRetries > 0 {
+			args = append(args, "--healthcheck-retries", fmt.Sprint(build.HealthcheckRetries))
+		}
+	}
+	return args
+}
+
+// helper function to create a working container from the built image,
+// apply the configuration arguments and commit it back to the image.
+// Every commit records the configured commit author and message.
+func (p Plugin) recommit(config []string, squash bool) error {
+	out, err := p.output(commandFrom(p.Build, p.Build.Name))
+	if err != nil {
+		return fmt.Errorf("Error creating working container: %s", err)
+	}
+	container := strings.TrimSpace(string(out))
+	defer p.run([]buildahCmd{commandRm(p.Build, container)})
+
+	config = append(commitMetadata(p.Build), config...)
+	cmds := []buildahCmd{
+		commandConfig(p.Build, container, config),
+		commandCommit(p.Build, container, p.Build.Name, squash),
+	}
+	return p.run(cmds)
+}
+
+// helper function to create the config arguments recording the commit
+// author and message on the image, defaulting the message to the git
+// commit the image was built from.
+func commitMetadata(build Build) []string {
+	var args []string
+	if build.CommitAuthor != "" {
+		args = append(args, "--author", build.CommitAuthor)
+	}
+	switch {
+	case build.CommitMessage != "":
+		args = append(args, "--comment", build.CommitMessage)
+	case build.Name != "":
+		args = append(args, "--comment", fmt.Sprintf("Built from commit %s", build.Name))
+	}
+	return args
+}
+
+// helper function to create the buildah from command.
+func commandFrom(build Build, image string) buildahCmd {
+	return newCommand(kindOther, "from", "--storage-driver", build.storageDriver(), "--pull=false", image)
+}
+
+// helper function to create the buildah config command.
+func commandConfig(build Build, container string, config []string) buildahCmd {
+	args := []string{"config", "--storage-driver", build.storageDriver()}
+	args = append(args, config...)
+	args = append(args, container)
+	return newCommand(kindOther, args...)
+}
+
+// helper function to create the buildah commit command. The history is
+// omitted and the timestamp set here too, since the commit would
+// otherwise add an entry to the image built without one and record the
+// wall-clock time in the reproducible image.
+func commandCommit(build Build, container, image string, squash bool) buildahCmd {
+	args := []string{"commit", "--storage-driver", build.storageDriver()}
+	if squash {
+		args = append(args, "--squash")
+	}
+	if build.OmitHistory {
+		args = append(args, "--omit-history")
+	}
+	if build.Timestamp != 0 {
+		args = append(args, "--timestamp", strconv.FormatInt(build.Timestamp, 10))
+	}
+	// healthchecks are only part of the docker image format
+	if build.Healthcheck != "" {
+		args = append(args, "--format", "docker")
+	}
+	args = append(args, container, image)
+	return newCommand(kindOther, args...)
+}
+
+// helper function to create the buildah rm command.
+func commandRm(build Build, container string) buildahCmd {
+	return newCommand(kindOther, "rm", "--storage-driver", build.storageDriver(), container)
+}
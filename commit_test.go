@@ -0,0 +1,63 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_commitMetadata(t *testing.T) {
+	tests := []struct {
+		Build Build
+		Want  []string
+	}{
+		{
+			Build: Build{},
+		},
+		{
+			Build: Build{Name: "d8dbe4d9"},
+			Want:  []string{"--comment", "Built from commit d8dbe4d9"},
+		},
+		{
+			Build: Build{Name: "d8dbe4d9", CommitAuthor: "octocat", CommitMessage: "release"},
+			Want:  []string{"--author", "octocat", "--comment", "release"},
+		},
+	}
+	for _, test := range tests {
+		if got := commitMetadata(test.Build); !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("Got arguments %v, want %v", got, test.Want)
+		}
+	}
+}
+
+func Test_runtimeConfig(t *testing.T) {
+	got := runtimeConfig(Build{
+		StopSignal:          "SIGQUIT",
+		Healthcheck:         "CMD curl -f http://localhost/",
+		HealthcheckInterval: "30s",
+		HealthcheckRetries:  3,
+	})
+	want := []string{
+		"--stop-signal", "SIGQUIT",
+		"--healthcheck", "CMD curl -f http://localhost/",
+		"--healthcheck-interval", "30s",
+		"--healthcheck-retries", "3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got arguments %v, want %v", got, want)
+	}
+
+	if got := runtimeConfig(Build{HealthcheckInterval: "30s"}); len(got) != 0 {
+		t.Errorf("Expect no arguments without a healthcheck, got %v", got)
+	}
+}
+
+func Test_commandCommit(t *testing.T) {
+	build := Build{Timestamp: 1700000000}
+	cmd := commandCommit(build, "working-container", "d8dbe4d9", false)
+	if !hasArgs(cmd.Args, "--timestamp", "1700000000") {
+		t.Errorf("Expect the build timestamp on the commit, got %v", cmd.Args)
+	}
+	if cmd := commandCommit(Build{}, "working-container", "d8dbe4d9", false); hasArg(cmd.Args, "--timestamp") {
+		t.Errorf("Unexpected timestamp without a build timestamp, got %v", cmd.Args)
+	}
+}
@@ -0,0 +1,126 @@
+package docker
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+)
+
+// default storage driver, which works unprivileged on any host.
+const defaultStorageDriver = "vfs"
+
+// helper function to return the storage driver, defaulting to vfs.
+func (b Build) storageDriver() string {
+	if b.StorageDriver == "" {
+		return defaultStorageDriver
+	}
+	return b.StorageDriver
+}
+
+// helper function to create the contents of the storage.conf for the
+// configured storage driver, storage paths and overlay mount program.
+// Unset storage paths keep the buildah defaults for the current user.
+func storageConf(build Build) string {
+	var sb strings.Builder
+	sb.WriteString("[storage]\n")
+	fmt.Fprintf(&sb, "driver = %q\n", build.storageDriver())
+	if build.GraphRoot != "" {
+		fmt.Fprintf(&sb, "graphroot = %q\n", build.GraphRoot)
+	}
+	if build.RunRoot != "" {
+		fmt.Fprintf(&sb, "runroot = %q\n", build.RunRoot)
+	}
+	if build.MountProgram != "" && build.storageDriver() == "overlay" {
+		sb.WriteString("\n[storage.options.overlay]\n")
+		fmt.Fprintf(&sb, "mount_program = %q\n", build.MountProgram)
+	}
+	return sb.String()
+}
+
+// workdir defines the per-invocation temp directory holding the files
+// the plugin writes. The directory is created inside the config dir on
+// first use, so concurrent invocations sharing a host never collide.
+type workdir struct {
+	home string // Base directory for the containers configuration
+	path string // Path of the directory, once created
+}
+
+// helper function to write data to a uniquely named file in the work
+// directory, returning its path.
+func (w *workdir) writeFile(pattern string, data []byte) (string, error) {
+	if w.path == "" {
+		dir, err := configDir(w.home)
+		if err != nil {
+			return "", err
+		}
+		if w.path, err = ioutil.TempDir(dir, "drone-buildah-"); err != nil {
+			return "", fmt.Errorf("Error creating temp dir: %s", err)
+		}
+	}
+
+	f, err := ioutil.TempFile(w.path, pattern)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := f.Chmod(0600); err != nil {
+		return "", err
+	}
+	if _, err := f.Write(data); err != nil {
+		return "", err
+	}
+	return f.Name(), f.Close()
+}
+
+// helper function to remove the work directory and its files.
+func (w *workdir) cleanup() {
+	if w.path != "" {
+		os.RemoveAll(w.path)
+	}
+}
+
+// helper function to resolve the home directory used as the base for
+// the containers configuration, falling back to $HOME and then to the
+// home directory of the current user.
+func resolveHome(home string) (string, error) {
+	if home != "" {
+		return home, nil
+	}
+	if home = os.Getenv("HOME"); home != "" {
+		return home, nil
+	}
+	u, err := user.Current()
+	if err != nil {
+		return "", fmt.Errorf("Error getting the current user: %s", err)
+	}
+	if u.HomeDir == "" {
+		return "", fmt.Errorf("Error resolving the home directory for user %s", u.Username)
+	}
+	return u.HomeDir, nil
+}
+
+// helper function to create the containers configuration directory and
+// verify it is writable.
+func configDir(home string) (string, error) {
+	home, err := resolveHome(home)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Join(home, ".config", "containers")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("Error creating config dir: %s", err)
+	}
+	f, err := ioutil.TempFile(dir, ".write-test")
+	if err != nil {
+		return "", fmt.Errorf("Error writing config dir %s: %s", dir, err)
+	}
+	f.Close()
+	os.Remove(f.Name())
+
+	fmt.Printf("Using config dir %s\n", dir)
+	return dir, nil
+}
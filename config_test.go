@@ -0,0 +1,115 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_configDir(t *testing.T) {
+	home, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	dir, err := configDir(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(home, ".config", "containers"); dir != want {
+		t.Errorf("Got config dir %s, want %s", dir, want)
+	}
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		t.Errorf("Expect config dir %s to be created", dir)
+	}
+}
+
+func Test_resolveHome(t *testing.T) {
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", "/home/octocat")
+
+	if got, _ := resolveHome("/mnt/config"); got != "/mnt/config" {
+		t.Errorf("Got home %s, want the override", got)
+	}
+	if got, _ := resolveHome(""); got != "/home/octocat" {
+		t.Errorf("Got home %s, want $HOME", got)
+	}
+}
+
+func Test_storageConf(t *testing.T) {
+	got := storageConf(Build{StorageDriver: "overlay", MountProgram: "/usr/bin/fuse-overlayfs"})
+	want := `[storage]
+driver = "overlay"
+
+[storage.options.overlay]
+mount_program = "/usr/bin/fuse-overlayfs"
+`
+	if got != want {
+		t.Errorf("Got storage.conf\n%s\nwant\n%s", got, want)
+	}
+
+	got = storageConf(Build{})
+	want = "[storage]\ndriver = \"vfs\"\n"
+	if got != want {
+		t.Errorf("Got storage.conf\n%s\nwant\n%s", got, want)
+	}
+
+	got = storageConf(Build{GraphRoot: "/cache/graph", RunRoot: "/cache/run"})
+	want = "[storage]\ndriver = \"vfs\"\ngraphroot = \"/cache/graph\"\nrunroot = \"/cache/run\"\n"
+	if got != want {
+		t.Errorf("Got storage.conf\n%s\nwant\n%s", got, want)
+	}
+
+	if err := (Build{MountProgram: "/usr/bin/fuse-overlayfs"}).validate(); err == nil {
+		t.Errorf("Expect error for mount program without the overlay driver")
+	}
+}
+
+func Test_storageConfNoShell(t *testing.T) {
+	builds := []Build{
+		{},
+		{StorageDriver: "overlay", MountProgram: "/usr/bin/fuse-overlayfs"},
+		{GraphRoot: "/cache/graph", RunRoot: "/cache/run"},
+	}
+	for _, build := range builds {
+		if got := storageConf(build); strings.Contains(got, "$(") {
+			t.Errorf("Unexpected shell substitution in storage.conf\n%s", got)
+		}
+	}
+}
+
+func Test_workdir(t *testing.T) {
+	home, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	a, b := &workdir{home: home}, &workdir{home: home}
+	pa, err := a.writeFile("auth-*.json", []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pb, err := b.writeFile("auth-*.json", []byte("b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pa == pb || filepath.Dir(pa) == filepath.Dir(pb) {
+		t.Errorf("Got shared paths %s and %s, want unique per invocation", pa, pb)
+	}
+	if data, _ := ioutil.ReadFile(pa); string(data) != "a" {
+		t.Errorf("Got contents %q, want %q", data, "a")
+	}
+
+	a.cleanup()
+	if _, err := os.Stat(filepath.Dir(pa)); !os.IsNotExist(err) {
+		t.Errorf("Expect work dir removed after cleanup")
+	}
+	if _, err := os.Stat(pb); err != nil {
+		t.Errorf("Expect other invocation's files untouched, got %s", err)
+	}
+	b.cleanup()
+}
@@ -0,0 +1,193 @@
+package docker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignorePattern defines a single build context ignore pattern.
+type ignorePattern struct {
+	re     *regexp.Regexp
+	negate bool
+}
+
+// helper function to check if the build context is a remote URL.
+func isRemoteContext(context string) bool {
+	for _, prefix := range []string{"http://", "https://", "git://", "git@"} {
+		if strings.HasPrefix(context, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// helper function to read the ignore patterns from the build context,
+// preferring .containerignore over .dockerignore.
+func readIgnorePatterns(dir string) ([]ignorePattern, error) {
+	var f *os.File
+	for _, name := range []string{".containerignore", ".dockerignore"} {
+		var err error
+		f, err = os.Open(filepath.Join(dir, name))
+		if err == nil {
+			break
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	if f == nil {
+		return nil, nil
+	}
+	defer f.Close()
+
+	var patterns []ignorePattern
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pattern := ignorePattern{}
+		if strings.HasPrefix(line, "!") {
+			pattern.negate = true
+			line = strings.TrimSpace(line[1:])
+		}
+		line = strings.Trim(filepath.ToSlash(filepath.Clean(line)), "/")
+		re, err := compileIgnorePattern(line)
+		if err != nil {
+			return nil, err
+		}
+		pattern.re = re
+		patterns = append(patterns, pattern)
+	}
+	return patterns, scanner.Err()
+}
+
+// helper function to convert an ignore pattern into a regular expression.
+func compileIgnorePattern(pattern string) (*regexp.Regexp, error) {
+	var sb strings.Builder
+	sb.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			sb.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			sb.WriteString(".*")
+			i++
+		case c == '*':
+			sb.WriteString("[^/]*")
+		case c == '?':
+			sb.WriteString("[^/]")
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString("$")
+	return regexp.Compile(sb.String())
+}
+
+// helper function to check if a context relative path is ignored. The
+// last matching pattern wins, and a path matches when it or any of its
+// parent directories match.
+func isIgnored(path string, patterns []ignorePattern) bool {
+	i := lastMatch(path, patterns)
+	return i >= 0 && !patterns[i].negate
+}
+
+// helper function to return the index of the last pattern matching a
+// context relative path or any of its parent directories, or -1.
+func lastMatch(path string, patterns []ignorePattern) int {
+	last := -1
+	for i, pattern := range patterns {
+		for p := path; p != "." && p != ""; p = filepath.ToSlash(filepath.Dir(p)) {
+			if pattern.re.MatchString(p) {
+				last = i
+				break
+			}
+		}
+	}
+	return last
+}
+
+// helper function to check if an ignored directory can be skipped as a
+// whole. Paths beneath it match the same pattern through their parent,
+// so only a later negation pattern could re-include one of them.
+func skipIgnoredDir(path string, patterns []ignorePattern) bool {
+	i := lastMatch(path, patterns)
+	if i < 0 || patterns[i].negate {
+		return false
+	}
+	for _, pattern := range patterns[i+1:] {
+		if pattern.negate {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function to compute the total size and number of files sent
+// to the build, honoring the context ignore file.
+func contextSize(dir string) (int64, int, error) {
+	patterns, err := readIgnorePatterns(dir)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	var (
+		size  int64
+		files int
+	)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() && skipIgnoredDir(rel, patterns) {
+			return filepath.SkipDir
+		}
+		if isIgnored(rel, patterns) {
+			return nil
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+			files++
+		}
+		return nil
+	})
+	return size, files, err
+}
+
+// helper function to log the size of the build context, warning when
+// it exceeds the configured threshold.
+func reportContextSize(build Build) error {
+	if isRemoteContext(build.Context) {
+		fmt.Printf("Build context %s is remote. Skipping size report\n", build.Context)
+		return nil
+	}
+
+	size, files, err := contextSize(build.Context)
+	if err != nil {
+		return fmt.Errorf("Error measuring build context: %s", err)
+	}
+	fmt.Printf("Build context %s: %d files, %s\n", build.Context, files, formatSize(size))
+
+	if build.ContextSizeWarn != "" {
+		limit, err := parseSize(build.ContextSizeWarn)
+		if err != nil {
+			return err
+		}
+		if size > limit {
+			fmt.Printf("Warning: build context size %s exceeds %s. Check the ignore file for stray directories\n", formatSize(size), formatSize(limit))
+		}
+	}
+	return nil
+}
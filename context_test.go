@@ -0,0 +1,101 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_isIgnored(t *testing.T) {
+	var patterns []ignorePattern
+	for _, line := range []string{".git", "node_modules", "**/*.log", "!keep.log"} {
+		negate := line[0] == '!'
+		if negate {
+			line = line[1:]
+		}
+		re, err := compileIgnorePattern(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, ignorePattern{re: re, negate: negate})
+	}
+
+	tests := map[string]bool{
+		".git/config":           true,
+		"node_modules/x/y.js":   true,
+		"build.log":             true,
+		"logs/build.log":        true,
+		"keep.log":              false,
+		"main.go":               false,
+		"cmd/node_modules_test": false,
+	}
+	for path, want := range tests {
+		if got := isIgnored(path, patterns); got != want {
+			t.Errorf("Got ignored %v for %s, want %v", got, path, want)
+		}
+	}
+}
+
+func Test_skipIgnoredDir(t *testing.T) {
+	var patterns []ignorePattern
+	for _, line := range []string{".git", "vendor", "!vendor/keep", "node_modules"} {
+		negate := line[0] == '!'
+		if negate {
+			line = line[1:]
+		}
+		re, err := compileIgnorePattern(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		patterns = append(patterns, ignorePattern{re: re, negate: negate})
+	}
+
+	tests := map[string]bool{
+		".git":         false, // a later negation may re-include a path beneath it
+		"vendor":       false,
+		"vendor/keep":  false,
+		"node_modules": true,
+		"src":          false,
+	}
+	for path, want := range tests {
+		if got := skipIgnoredDir(path, patterns); got != want {
+			t.Errorf("Got skip %v for %s, want %v", got, path, want)
+		}
+	}
+}
+
+func Test_contextSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		".dockerignore":       "# ignore dependencies\nnode_modules\nvendor\n!vendor/keep.go\n",
+		"Dockerfile":          "FROM alpine\n",
+		"node_modules/dep.js": "ignored",
+		"src/main.go":         "package main\n",
+		"vendor/dep.go":       "ignored",
+		"vendor/keep.go":      "package keep\n",
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	size, count, err := contextSize(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(len(files[".dockerignore"]) + len(files["Dockerfile"]) + len(files["src/main.go"]) + len(files["vendor/keep.go"])); size != want {
+		t.Errorf("Got size %d, want %d", size, want)
+	}
+	if count != 4 {
+		t.Errorf("Got %d files, want 4", count)
+	}
+}
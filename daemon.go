@@ -0,0 +1,55 @@
+package docker
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+)
+
+// default docker daemon socket.
+const dockerSocket = "/var/run/docker.sock"
+
+// helper function to load the built image into the local docker daemon
+// under each tag.
+func (p Plugin) loadToDocker(tags []string) error {
+	if err := checkDockerDaemon(); err != nil {
+		return fmt.Errorf("Error loading image into docker: %s", err)
+	}
+	var cmds []buildahCmd
+	for _, tag := range tags {
+		cmds = append(cmds, commandPushDaemon(p.Build, tag))
+	}
+	if err := p.run(cmds); err != nil {
+		return fmt.Errorf("Error loading image into docker: %s", err)
+	}
+	return nil
+}
+
+// helper function to check the docker daemon socket is reachable. Only
+// unix sockets can be checked; other DOCKER_HOST values are assumed to
+// be reachable.
+func checkDockerDaemon() error {
+	socket := dockerSocket
+	if host := os.Getenv("DOCKER_HOST"); host != "" {
+		u, err := url.Parse(host)
+		if err != nil || u.Scheme != "unix" {
+			return nil
+		}
+		socket = u.Path
+	}
+	info, err := os.Stat(socket)
+	if err != nil {
+		return fmt.Errorf("docker daemon not reachable: %s", err)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("docker daemon not reachable: %s is not a socket", socket)
+	}
+	return nil
+}
+
+// helper function to create the push command loading the image into
+// the docker daemon.
+func commandPushDaemon(build Build, tag string) buildahCmd {
+	target := fmt.Sprintf("docker-daemon:%s", build.tagRef(tag))
+	return newCommand(kindPush, "push", "--storage-driver", build.storageDriver(), build.Name, target)
+}
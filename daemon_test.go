@@ -0,0 +1,37 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_commandPushDaemon(t *testing.T) {
+	cmd := commandPushDaemon(Build{Name: "d8dbe4d9", Repo: "octocat/hello-world"}, "latest")
+	want := []string{buildahExe, "push", "--storage-driver", "vfs", "d8dbe4d9", "docker-daemon:octocat/hello-world:latest"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+}
+
+func Test_checkDockerDaemon(t *testing.T) {
+	defer os.Setenv("DOCKER_HOST", os.Getenv("DOCKER_HOST"))
+
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	os.Setenv("DOCKER_HOST", "unix://"+filepath.Join(dir, "docker.sock"))
+	if err := checkDockerDaemon(); err == nil {
+		t.Errorf("Expect error for a missing docker socket")
+	}
+
+	os.Setenv("DOCKER_HOST", "tcp://docker:2375")
+	if err := checkDockerDaemon(); err != nil {
+		t.Errorf("Unexpected error for a tcp docker host: %s", err)
+	}
+}
@@ -0,0 +1,131 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// default key the deploy snippet is written under.
+const defaultDeploySnippetKey = "images"
+
+// helper function to return the tags pushed to the registry. When
+// pushing by digest only, the image is pushed once under the build name,
+// as registries need a reference to upload the manifest, and the
+// configured tags are only recorded in the digest file.
+func (b Build) pushTags(tags []string) []string {
+	if b.DigestOnly {
+		return []string{b.Name}
+	}
+	return tags
+}
+
+// helper function to report whether the push captures the digests,
+// which the digest file, deploy snippet, build log, build metadata and
+// GitHub outputs record.
+func (p Plugin) captureDigests() bool {
+	return p.Build.DigestFile != "" || p.Build.DeploySnippetFile != "" || p.Build.AttachLogs ||
+		p.OutputFile != "" || p.GithubOutput
+}
+
+// helper function to map each tag reference Repo:tag to the digest
+// reference Repo@sha256:<digest> it was pushed as. The digests are read
+// from the files written by buildah push --digestfile. It also returns
+// the first digest.
+func digestRefs(build Build, tags []string, files map[string]string) (map[string]string, string, error) {
+	digests := map[string]string{}
+	for tag, path := range files {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, "", fmt.Errorf("Error reading digest of %s: %s", tag, err)
+		}
+		digests[tag] = strings.TrimSpace(string(data))
+	}
+
+	var first string
+	refs := map[string]string{}
+	for _, tag := range tags {
+		digest := digests[tag]
+		if build.DigestOnly {
+			digest = digests[build.Name]
+		}
+		if digest == "" {
+			continue
+		}
+		if first == "" {
+			first = digest
+		}
+		refs[build.tagRef(tag)] = fmt.Sprintf("%s@%s", build.tagRepo(tag), digest)
+	}
+	return refs, first, nil
+}
+
+// helper function to write the digest references to a JSON file.
+func writeDigestFile(path string, refs map[string]string) error {
+	data, err := json.MarshalIndent(refs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("Error writing digest file: %s", err)
+	}
+
+	fmt.Printf("Digests written to %s\n", path)
+	return nil
+}
+
+// helper function to write the digest references as a YAML snippet
+// under the key, ready to paste into a Kubernetes manifest or Helm
+// values. The snippet lists each pushed tag with its digest reference.
+func writeDeploySnippet(path, key string, refs map[string]string) error {
+	if key == "" {
+		key = defaultDeploySnippetKey
+	}
+	var tags []string
+	for tag := range refs {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s:\n", key)
+	for _, tag := range tags {
+		// double quoted JSON strings are valid YAML scalars
+		fmt.Fprintf(&buf, "  - tag: %s\n    image: %s\n", strconv.Quote(tag), strconv.Quote(refs[tag]))
+	}
+	if err := writeOutputFile(path, buf.Bytes()); err != nil {
+		return fmt.Errorf("Error writing deploy snippet: %s", err)
+	}
+
+	fmt.Printf("Deploy snippet written to %s\n", path)
+	return nil
+}
+
+// helper function to write a file for downstream steps, creating its
+// parent directory if missing.
+func writeOutputFile(path string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// helper function to create the docker push command recording the
+// digest of the pushed image or manifest list.
+func commandPushDigest(build Build, tag, digestfile string) buildahCmd {
+	cmd := commandPush(build, tag)
+	i := 2 // after buildah push
+	if build.multiPlatform() {
+		i = 3 // after buildah manifest push
+	}
+	args := append([]string{}, cmd.Args[:i]...)
+	args = append(args, "--digestfile", digestfile)
+	cmd.Args = append(args, cmd.Args[i:]...)
+	return cmd
+}
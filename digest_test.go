@@ -0,0 +1,176 @@
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_writeDigests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	const digest = "sha256:3b2a7c9e"
+	digestfile := filepath.Join(dir, "digest")
+	if err := ioutil.WriteFile(digestfile, []byte(digest+"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	build := Build{
+		Name:       "d8dbe4d9",
+		Repo:       "octocat/hello-world",
+		DigestOnly: true,
+		DigestFile: filepath.Join(dir, "out", "digests.json"),
+	}
+	if got := build.pushTags([]string{"latest", "1.0"}); !reflect.DeepEqual(got, []string{"d8dbe4d9"}) {
+		t.Errorf("Got pushed tags %v, want only the build name", got)
+	}
+
+	refs, got, err := digestRefs(build, []string{"latest", "1.0"}, map[string]string{"d8dbe4d9": digestfile})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != digest {
+		t.Errorf("Got digest %s, want %s", got, digest)
+	}
+	if err := writeDigestFile(build.DigestFile, refs); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(build.DigestFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]string
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"octocat/hello-world:latest": "octocat/hello-world@sha256:3b2a7c9e",
+		"octocat/hello-world:1.0":    "octocat/hello-world@sha256:3b2a7c9e",
+	}
+	if !reflect.DeepEqual(decoded, want) {
+		t.Errorf("Got references %v, want %v", decoded, want)
+	}
+}
+
+func Test_writeDeploySnippet(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "values.yaml")
+	refs := map[string]string{
+		"octocat/hello-world:latest": "octocat/hello-world@sha256:3b2a7c9e",
+		"octocat/hello-world:1.0":    "octocat/hello-world@sha256:3b2a7c9e",
+	}
+	if err := writeDeploySnippet(path, "", refs); err != nil {
+		t.Fatal(err)
+	}
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `images:
+  - tag: "octocat/hello-world:1.0"
+    image: "octocat/hello-world@sha256:3b2a7c9e"
+  - tag: "octocat/hello-world:latest"
+    image: "octocat/hello-world@sha256:3b2a7c9e"
+`
+	if string(got) != want {
+		t.Errorf("Got snippet\n%s\nwant\n%s", got, want)
+	}
+}
+
+func Test_commandPushDigest(t *testing.T) {
+	cmd := commandPushDigest(Build{Repo: "octocat/hello-world"}, "latest", "/tmp/digest")
+	want := []string{buildahExe, "push", "--digestfile", "/tmp/digest", "--storage-driver", "vfs", "octocat/hello-world:latest"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+
+	build := Build{Name: "d8dbe4d9", Repo: "octocat/hello-world", Platforms: []string{"linux/amd64", "linux/arm64"}}
+	cmd = commandPushDigest(build, "latest", "/tmp/digest")
+	want = []string{
+		buildahExe, "manifest", "push", "--digestfile", "/tmp/digest", "--storage-driver", "vfs",
+		"--all", "d8dbe4d9", "docker://octocat/hello-world:latest",
+	}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+}
+
+func TestExecMetadataDigest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// buildah stand-in writing the digest file of the push
+	script := `#!/bin/sh
+while [ $# -gt 0 ]; do
+	case "$1" in
+	version) echo "Version: 1.33.0" ;;
+	--digestfile) echo sha256:3b2a7c9e > "$2" ;;
+	esac
+	shift
+done
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, buildahExe), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	output := filepath.Join(dir, "metadata.json")
+	p := Plugin{
+		Build: Build{
+			Name:       "d8dbe4d9",
+			Repo:       "octocat/hello-world",
+			Tags:       []string{"latest"},
+			Dockerfile: filepath.Join(dir, "Dockerfile"),
+			Context:    dir,
+		},
+		ConfigHome: dir,
+		OutputFile: output,
+	}
+	if err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var meta metadata
+	if err := json.Unmarshal(data, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if meta.Digest != "sha256:3b2a7c9e" {
+		t.Errorf("Got digest %q in the build metadata, want sha256:3b2a7c9e", meta.Digest)
+	}
+
+	// the GitHub outputs alone capture the digest too
+	github := filepath.Join(dir, "github-output")
+	defer os.Setenv("GITHUB_OUTPUT", os.Getenv("GITHUB_OUTPUT"))
+	os.Setenv("GITHUB_OUTPUT", github)
+	p.OutputFile, p.GithubOutput = "", true
+	if err := p.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(github); !strings.Contains(string(data), "digest=sha256:3b2a7c9e\n") {
+		t.Errorf("Got GitHub outputs %q, want the pushed digest", data)
+	}
+}
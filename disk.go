@@ -0,0 +1,89 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// interval between graphroot size checks while a build runs.
+var graphrootCheckInterval = 5 * time.Second
+
+// helper function to return the storage graph root, defaulting to the
+// buildah default for the current user.
+func graphRoot(build Build) (string, error) {
+	if build.GraphRoot != "" {
+		return build.GraphRoot, nil
+	}
+	if os.Geteuid() == 0 {
+		return "/var/lib/containers/storage", nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+		return filepath.Join(dir, "containers", "storage"), nil
+	}
+	home, err := resolveHome("")
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "containers", "storage"), nil
+}
+
+// helper function to return the total size of the files in the
+// directory. Files removed while walking are skipped, since the
+// directory is in use by the build.
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// helper function to check the graphroot against the size budget
+// before the build and then periodically while it runs. The returned
+// channel reports an error once the budget is exceeded, and the stop
+// function ends the periodic checks.
+func (p Plugin) watchGraphroot() (<-chan error, func(), error) {
+	limit, err := parseSize(p.Build.MaxGraphrootSize)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid graphroot size budget: %s", err)
+	}
+	root, err := graphRoot(p.Build)
+	if err != nil {
+		return nil, nil, err
+	}
+	check := func() error {
+		if size := dirSize(root); size > limit {
+			return fmt.Errorf("Graphroot %s is %s, exceeding the budget of %s", root, formatSize(size), formatSize(limit))
+		}
+		return nil
+	}
+	if err := check(); err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		abort = make(chan error, 1)
+		stop  = make(chan struct{})
+	)
+	go func() {
+		ticker := time.NewTicker(graphrootCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				if err := check(); err != nil {
+					abort <- err
+					return
+				}
+			}
+		}
+	}()
+	return abort, func() { close(stop) }, nil
+}
@@ -0,0 +1,52 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_watchGraphroot(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	root, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	interval := graphrootCheckInterval
+	graphrootCheckInterval = 10 * time.Millisecond
+	defer func() { graphrootCheckInterval = interval }()
+
+	if err := ioutil.WriteFile(filepath.Join(root, "layer"), make([]byte, 512), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got := dirSize(root); got != 512 {
+		t.Errorf("Got graphroot size %d, want 512", got)
+	}
+
+	p := Plugin{Build: Build{GraphRoot: root, MaxGraphrootSize: "1k"}}
+	abort, stop, err := p.watchGraphroot()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+
+	// the build grows the graphroot past the budget
+	p.abort = abort
+	big := filepath.Join(root, "big")
+	err = p.runCmd(exec.Command("sh", "-c", "head -c 4096 /dev/zero > "+big+"; sleep 10"))
+	if err == nil || !strings.Contains(err.Error(), "exceeding the budget of 1.0KiB") {
+		t.Errorf("Got error %v, want the build aborted", err)
+	}
+
+	if _, _, err := p.watchGraphroot(); err == nil {
+		t.Errorf("Expect error before the build when the budget is already exceeded")
+	}
+}
@@ -1,12 +1,16 @@
 package docker
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
-	"os/user"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -16,82 +20,340 @@ const buildahExe = "buildah"
 type (
 	// Login defines Docker login parameters.
 	Login struct {
-		Registry string // Docker registry address
-		Username string // Docker registry username
-		Password string // Docker registry password
-		Email    string // Docker registry email
-		Config   string // Docker Auth Config
+		Registry  string // Docker registry address
+		Username  string // Docker registry username
+		Password  string // Docker registry password
+		Email     string // Docker registry email
+		Config    string // Docker Auth Config
+		TLSVerify *bool  // Docker registry TLS verification, unset uses the buildah default
 	}
 
 	// Build defines Docker build parameters.
 	Build struct {
-		Remote      string   // Git remote URL
-		Name        string   // Docker build using default named tag
-		Dockerfile  string   // Docker build Dockerfile
-		Context     string   // Docker build context
-		Tags        []string // Docker build tags
-		Args        []string // Docker build args
-		ArgsEnv     []string // Docker build args from env
-		Target      string   // Docker build target
-		Squash      bool     // Docker build squash
-		Pull        bool     // Docker build pull
-		CacheFrom   []string // Docker build cache-from. It is a NOOP in buildah
-		Compress    bool     // Docker build compress
-		Repo        string   // Docker build repository
-		LabelSchema []string // label-schema Label map
-		AutoLabel   bool     // auto-label bool
-		Labels      []string // Label map
-		Link        string   // Git repo link
-		NoCache     bool     // Docker build no-cache
-		AddHost     []string // Docker build add-host
-		Quiet       bool     // Docker build quiet
-		S3CacheDir  string
-		S3Bucket    string
-		S3Endpoint  string
-		S3Region    string
-		S3Key       string
-		S3Secret    string
-		S3UseSSL    bool
-		Layers      bool
+		Remote                      string   // Git remote URL
+		Name                        string   // Docker build using default named tag
+		Dockerfile                  string   // Docker build Dockerfile, an http(s) URL or - for stdin
+		Context                     string   // Docker build context
+		Tags                        []string // Docker build tags
+		AutoTag                     bool     // Docker build tags generated from Version
+		AutoTagSuffix               string   // Docker build tags suffix for the generated tags
+		Version                     string   // Semantic version the tags are generated from
+		Args                        []string // Docker build args
+		ArgsEnv                     []string // Docker build args from env
+		ArgsFile                    string   // Docker build args file with KEY=VALUE lines
+		NoProxyHosts                []string // Hosts added to the no_proxy build args
+		Target                      string   // Docker build target
+		Isolation                   string   // Buildah isolation (oci, rootless or chroot)
+		Squash                      bool     // Docker build squash
+		SquashAll                   bool     // Docker build squash including the base image layers
+		OmitHistory                 bool     // Layer history omitted from the image config
+		Timestamp                   int64    // Docker build layer and config timestamp in Unix seconds
+		Pull                        bool     // Docker build pull
+		CacheFrom                   []string // Docker build cache-from. It is a NOOP in buildah
+		Compress                    bool     // Docker build compress
+		Repo                        string   // Docker build repository
+		Repos                       []string // Docker build repositories, taking precedence over Repo
+		LabelSchema                 []string // label-schema Label map
+		AutoLabel                   bool     // auto-label bool
+		Labels                      []string // Label map
+		LabelsFile                  string   // Labels file with key=value lines, overridden by Labels
+		Link                        string   // Git repo link
+		Branch                      string   // Git commit branch
+		NoCache                     bool     // Docker build no-cache
+		AddHost                     []string // Docker build add-host
+		CapAdd                      []string // Docker build capabilities added to RUN steps
+		CapDrop                     []string // Docker build capabilities dropped from RUN steps
+		Volumes                     []string // Docker build volumes mounted into RUN steps (source:destination[:options])
+		Memory                      string   // Docker build memory limit, e.g. 2g
+		Network                     string   // Docker build RUN network (none, host, private, ns:<path> or a network name)
+		SBOM                        bool     // Docker build SBOM generated for the image
+		SBOMScanner                 string   // SBOM scan preset, defaults to syft-spdx
+		SBOMOutput                  string   // SBOM written to this file
+		Sign                        bool     // Pushed tags, variants and mapped targets signed with cosign
+		CosignKey                   string   // Cosign private key, as a path, KMS URI or PEM contents
+		CosignPassword              string   // Cosign private key password
+		CPUShares                   int64    // Docker build CPU shares
+		CPUQuota                    int64    // Docker build CPU quota in microseconds per period
+		Quiet                       bool     // Docker build quiet
+		S3CacheDir                  string
+		S3Bucket                    string
+		S3Endpoint                  string
+		S3Region                    string
+		S3Key                       string
+		S3Secret                    string
+		S3UseSSL                    bool
+		Layers                      bool
+		Lint                        bool                // Dockerfile lint before build
+		Linter                      string              // Dockerfile linter (builtin, hadolint or a command)
+		AddHistory                  *bool               // Docker build add-history
+		TagsFile                    string              // Docker build tags read from file
+		SanitizeTags                bool                // Docker build tags are sanitized
+		CgroupManager               string              // Buildah global cgroup manager
+		SquashIfLargerThan          string              // Docker build squashed when the image exceeds this size
+		CommitAuthor                string              // Author recorded on committed images
+		CommitMessage               string              // Message recorded on committed images
+		ParallelCachePull           bool                // Docker build cache-from images pulled concurrently
+		ReportContextSize           bool                // Build context size is logged before the build
+		ContextSizeWarn             string              // Build context size that triggers a warning
+		SeccompProfile              string              // Docker build seccomp profile path
+		TagWithSHA                  bool                // Docker build tagged with the short commit sha
+		SHALength                   int                 // Length of the short commit sha tag
+		KeepStages                  bool                // Docker build intermediate stages are kept
+		MaxImageSize                string              // Docker build fails when the image exceeds this size
+		InheritLabels               []string            // Label keys copied from the base image
+		StagingTag                  string              // Docker build staging tag pushed before the final tags
+		VerifyCommand               []string            // Command verifying the staging image
+		StagingCleanup              bool                // Staging tag deleted when verification fails
+		BuildHostname               string              // Docker build container hostname
+		AssertEntrypoint            string              // Entrypoint the image is expected to have
+		AssertCmd                   []string            // Cmd the image is expected to have
+		Variants                    []Variant           // Docker build variants pushed to their own tags
+		TargetMap                   map[string]string   // Docker build targets built in addition to Target and pushed to their own repos with the tags, except full image references
+		StorageDriver               string              // Buildah storage driver, defaults to vfs
+		MountProgram                string              // Overlay storage mount program
+		GraphRoot                   string              // Buildah storage graph root
+		RunRoot                     string              // Buildah storage run root
+		BuildOnlyStorage            bool                // Storage config only applied to the build, not to pulls
+		WarmContexts                []string            // Build contexts built only to warm the layer cache
+		WarmContinueOnError         bool                // Warm context failures are ignored
+		StopSignal                  string              // Image stop signal
+		Healthcheck                 string              // Image healthcheck command
+		HealthcheckInterval         string              // Image healthcheck interval
+		HealthcheckTimeout          string              // Image healthcheck timeout
+		HealthcheckStartPeriod      string              // Image healthcheck start period
+		HealthcheckRetries          int                 // Image healthcheck retries
+		SmokeTest                   []string            // Command run inside the built image before pushing
+		TagArgs                     map[string][]string // Docker build args applied only when building the tag
+		AnnotationsFile             string              // Image labels and annotations written to this file
+		BaseLockFile                string              // Base image digests written to this file
+		RebuildStages               []string            // Docker build stages rebuilt without the layer cache
+		CacheRegistryCreds          string              // Cache registry credentials (user:pass), used for the cache registries without login credentials only
+		BuildInfoLabel              bool                // Docker build configuration stamped as a label
+		BuildInfoLabelKey           string              // Label key the build configuration is stamped under
+		BasePullPolicy              string              // Docker build base image pull policy (always, missing, never or newer)
+		LoadToDocker                bool                // Docker build image loaded into the local docker daemon
+		StageArgs                   map[string][]string // Docker build args for named stages
+		ReportCacheStats            bool                // Docker build cache hits and misses are logged
+		ForcePush                   bool                // Protected tags deleted from the registry before pushing; the delete is by digest and removes every tag sharing it
+		ForcePushTags               []string            // Tags the force push is confirmed for
+		ManifestAutoAnnotate        bool                // Manifest list annotated with the git metadata
+		DigestFile                  string              // Tag to digest references written to this file
+		DigestOnly                  bool                // Docker build pushed by digest, skipping the tags
+		RequirePinnedBase           bool                // Docker build fails for base images not pinned by digest
+		PinnedBaseAllowlist         []string            // Base images allowed without a digest pin
+		Nice                        int                 // Build and push commands run with this nice value
+		IONice                      string              // Build and push commands run with this io priority (class[:level])
+		DeploySnippetFile           string              // Digest pinned deploy snippet written to this file
+		DeploySnippetKey            string              // YAML key the deploy snippet is written under
+		Platforms                   []string            // Docker build target platforms
+		PostCommands                [][]string          // Commands run after all pushes succeed
+		PostCommandsContinueOnError bool                // Post command failures are ignored
+		RequiredArgs                []string            // Docker build args that must be set
+		RequireDeclaredArgs         bool                // Docker build fails for declared args without a default that are not set
+		Ref                         string              // Git commit ref
+		BuildNumber                 int                 // Drone build number
+		TagTemplates                []string            // Docker build tags rendered from Go templates
+		CreateRepo                  bool                // Registry repository created before the first push
+		AttachLogs                  bool                // Build log attached to the pushed image as an OCI referrer
+		CommandTimeout              time.Duration       // Maximum duration of each command
+		PushRetries                 int                 // Failed pushes retried this many times
+		PushRetryDelay              time.Duration       // Delay between push attempts
+		IgnorePushErrors            bool                // Push failures are logged and ignored
+		VerifyImage                 string              // Existing image verified instead of building
+		TLSVerify                   *bool               // Docker registry TLS verification for pushes and pulls, unset uses the buildah default
+		MaxGraphrootSize            string              // Docker build aborted when the storage graphroot exceeds this size
+		CacheToTemplate             string              // Docker build cache-to repository, rendered from a Go template
+		CacheTo                     []string            // Docker build cache-to repositories, including the rendered CacheToTemplate
+		InlineCache                 bool                // Docker build layer cache pushed to and reused from the image repository
+		CommandPrefix               []string            // Buildah commands run through this wrapper, e.g. sudo -n, with the plugin environment passed via env
+		SSHAgents                   []string            // Docker build ssh agent sockets or keys (id[=path])
+		SSHDefault                  bool                // Docker build forwards the host ssh agent
+
+		authFile string // Auth file scoping the cache registry credentials to the cache registries
+	}
+
+	// Variant defines a build variant pushed to its own tag. The
+	// variant is built with the global build args merged with the
+	// variant args, which take precedence on key collision.
+	Variant struct {
+		Tag  string   `json:"tag"`  // Docker build variant tag
+		Args []string `json:"args"` // Docker build variant args
 	}
 
 	// Plugin defines the Docker plugin parameters.
 	Plugin struct {
-		Login   Login // Docker login configuration
-		Build   Build // Docker build configuration
-		Dryrun  bool  // Docker push is skipped
-		Cleanup bool  // Docker purge is enabled
+		Login             Login         // Docker login configuration
+		Build             Build         // Docker build configuration
+		Dryrun            bool          // Docker push is skipped
+		Preview           bool          // Commands are printed without being run
+		Cleanup           bool          // Docker purge is enabled
+		Prune             bool          // Unused images and build cache removed after the run
+		SlackWebhook      string        // Slack webhook notified after the run
+		MaxConcurrency    int           // Maximum number of concurrent operations
+		ConfigHome        string        // Base directory for the containers configuration
+		HandleRateLimits  bool          // Rate limited pulls are retried
+		RateLimitMaxWait  time.Duration // Maximum time spent waiting on rate limits
+		MinBuildahVersion string        // Minimum buildah version required
+		Mirror            Login         // Mirror registry login configuration
+		MirrorAsync       bool          // Mirror pushed in the background, ignoring failures
+		Timeout           time.Duration // Maximum duration of the plugin run
+		CleanAuth         bool          // Login credentials removed after the run
+		Verbose           bool          // Buildah version and info streamed to the logs
+		CaptureStdout     bool          // Command output captured instead of streamed
+		CaptureStderr     bool          // Command errors captured instead of streamed
+		StdoutFile        string        // File the captured output is written to
+		StderrFile        string        // File the captured errors are written to
+		Logout            bool          // Registries logged out of after the run
+		GithubOutput      bool          // Image, digest and tags written to $GITHUB_OUTPUT
+		OutputFile        string        // Build metadata written to this file as JSON
+		RetryBudget       int           // Maximum number of retries across the run
+
+		storageConf string       // Path of the generated storage.conf
+		work        *workdir     // Per-invocation temp directory
+		deadline    time.Time    // Time the plugin run times out
+		out         *outputs     // Destinations of the command output
+		buildLog    *os.File     // Build output recorded for the log artifact
+		abort       <-chan error // Aborts the running command when it reports an error
+		retries     *retryBudget // Retries left for the run, unlimited when nil
 	}
 )
 
 // Exec executes the plugin step
 func (p Plugin) Exec() error {
+	start := time.Now()
+	if len(p.Build.Repos) != 0 {
+		p.Build.Repo = p.Build.Repos[0]
+	}
+	sum := &summary{
+		Image:  p.Build.Name,
+		Repo:   p.Build.Repo,
+		Commit: p.Build.Name,
+		Branch: p.Build.Branch,
+	}
+
+	p.work = &workdir{home: p.ConfigHome}
+	defer p.work.cleanup()
+	var err error
+	if p.out, err = newOutputs(p); err != nil {
+		return err
+	}
+	defer p.out.close()
+	if p.Timeout > 0 {
+		p.deadline = start.Add(p.Timeout)
+	}
+	if p.RetryBudget > 0 {
+		p.retries = &retryBudget{left: p.RetryBudget}
+	}
+	err = p.exec(sum)
+	sum.Stdout, sum.Stderr = p.out.buffer.stdout.String(), p.out.buffer.stderr.String()
+	if p.timedOut() && (p.Cleanup || p.Prune) {
+		// lift the deadline so the cleanup is still attempted
+		cleanup := p
+		cleanup.deadline = time.Time{}
+		cleanup.run(p.cleanupCommands(sum.Tags))
+	}
+	if p.Logout {
+		// lift the deadline so the credentials are still removed
+		logout := p
+		logout.deadline = time.Time{}
+		logout.run(p.logoutSteps())
+	}
+	sum.Duration = time.Since(start)
+	sum.Err = err
+
+	if p.OutputFile != "" && err == nil {
+		err = writeMetadata(p.OutputFile, sum, p.Build.Platforms)
+		sum.Err = err
+	}
+
+	if p.GithubOutput && err == nil {
+		if gerr := writeGithubOutput(os.Getenv("GITHUB_OUTPUT"), sum); gerr != nil {
+			fmt.Printf("Could not write GitHub outputs: %s. Ignoring...\n", gerr)
+		}
+	}
+
+	if p.SlackWebhook != "" && !p.Preview {
+		if serr := notifySlack(p.SlackWebhook, sum); serr != nil {
+			fmt.Printf("Could not send Slack notification: %s. Ignoring...\n", serr)
+		}
+	}
+
+	return err
+}
+
+// exec runs the plugin commands, recording the results in the summary.
+// The plugin is updated in place, so the cleanup after a timeout sees
+// the generated storage config and the resolved build settings.
+func (p *Plugin) exec(sum *summary) error {
+	var err error
+	if isRemoteDockerfile(p.Build.Dockerfile) || p.Build.Dockerfile == "-" {
+		if p.Build.Dockerfile, err = p.fetchDockerfile(); err != nil {
+			return err
+		}
+	}
+	if p.Build.Dockerfile, err = defaultDockerfile(p.Build); err != nil && p.Build.VerifyImage == "" {
+		return err
+	}
+	if err := p.Build.validate(); err != nil {
+		return err
+	}
+	if p.Build.Squash && p.Build.SquashAll {
+		fmt.Println("Squash and squash-all are mutually exclusive. Using --squash-all")
+	}
+	if p.Build.LabelsFile != "" {
+		if p.Build.Labels, err = p.Build.mergeLabelsFile(); err != nil {
+			return err
+		}
+	}
+	if p.MinBuildahVersion != "" {
+		if _, err := parseVersion(p.MinBuildahVersion); err != nil {
+			return fmt.Errorf("Invalid minimum buildah version: %s", err)
+		}
+	}
+
 	// Create Auth Config File
 	if p.Login.Config != "" {
-		user, err := user.Current()
+		path, err := p.work.writeFile("auth-*.json", []byte(p.Login.Config))
 		if err != nil {
-			return fmt.Errorf("Error getting the current user: %s", err)
+			return fmt.Errorf("Error writing auth.json: %s", err)
 		}
-		root := fmt.Sprintf("/var/tmp/%s/containers/containers/", user.Uid)
-		if err := os.MkdirAll(root, 0777); err != nil {
-			return fmt.Errorf("Error writing runtime dir: %s", err)
+		os.Setenv("REGISTRY_AUTH_FILE", path)
+
+		fmt.Printf("Config written to %s\n", path)
+	}
+
+	// Create Storage Config File
+	if p.Build.StorageDriver != "" || p.Build.MountProgram != "" || p.Build.GraphRoot != "" || p.Build.RunRoot != "" {
+		path, err := p.work.writeFile("storage-*.conf", []byte(storageConf(p.Build)))
+		if err != nil {
+			return fmt.Errorf("Error writing storage.conf: %s", err)
 		}
+		p.storageConf = path
 
-		path := filepath.Join(root, "auth.json")
-		if err := ioutil.WriteFile(path, []byte(p.Login.Config), 0600); err != nil {
+		fmt.Printf("Storage config written to %s\n", path)
+	}
+
+	// keep the login credentials in a temp auth file removed after the
+	// run, unless the user points the plugin at an auth file
+	if p.CleanAuth && p.Login.Config == "" && os.Getenv("REGISTRY_AUTH_FILE") == "" &&
+		(p.Login.Password != "" || p.Mirror.Password != "") {
+		path, err := p.work.writeFile("auth-*.json", []byte("{}"))
+		if err != nil {
 			return fmt.Errorf("Error writing auth.json: %s", err)
 		}
-
-		fmt.Printf("Config written to %s\n", path)
+		os.Setenv("REGISTRY_AUTH_FILE", path)
 	}
 
 	// login to the Docker registry
-	if p.Login.Password != "" {
+	if p.Preview {
+		fmt.Println("Preview mode enabled. Commands are printed without being run")
+	} else if p.Login.Password != "" {
 		cmd := commandLogin(p.Login)
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		err := cmd.Run()
+		p.prepare(cmd)
+		stderr := p.out.attach(cmd.Cmd)
+		err := p.runCmd(cmd.Cmd)
 		if err != nil {
+			reportCaptured(cmd.Cmd, stderr)
 			return fmt.Errorf("Error authenticating: %s", err)
 		}
 	}
@@ -105,133 +367,1071 @@ func (p Plugin) Exec() error {
 		fmt.Println("Registry credentials or Docker config not provided. Guest mode enabled.")
 	}
 
+	// verify an existing image instead of building
+	if p.Build.VerifyImage != "" {
+		return p.verifyImage()
+	}
+
+	tags, err := p.tags()
+	if err != nil {
+		return err
+	}
+
+	// lint the Dockerfile before the expensive build starts
+	if p.Build.Lint {
+		if err := p.lint(); err != nil {
+			return err
+		}
+	}
+
+	// reject base images not pinned by digest
+	if p.Build.RequirePinnedBase {
+		if err := checkPinnedBase(p.Build); err != nil {
+			return err
+		}
+	}
+
+	if p.Build.ReportContextSize {
+		if err := reportContextSize(p.Build); err != nil {
+			return err
+		}
+	}
+
+	// add the stage args, warning about args no stage declares
+	if len(p.Build.StageArgs) != 0 {
+		args, err := stageArgs(p.Build)
+		if err != nil {
+			return err
+		}
+		p.Build.Args = append(p.Build.Args, args...)
+	}
+
+	// invalidate the layer cache of the rebuilt stages
+	if len(p.Build.RebuildStages) != 0 {
+		if err := p.rebuildStages(); err != nil {
+			return err
+		}
+	}
+
 	// add proxy build args
 	addProxyBuildArgs(&p.Build)
 
-	var cmds []*exec.Cmd
-	cmds = append(cmds, commandVersion()) // docker version
-	cmds = append(cmds, commandInfo())    // docker info
+	// render the repository the layer cache is pushed to
+	if p.Build.CacheToTemplate != "" && p.Build.Layers {
+		repo, err := renderCacheTo(p.Build, newTagContext(p.Build, time.Now()))
+		if err != nil {
+			return err
+		}
+		p.Build.CacheTo = append(p.Build.CacheTo, repo)
+	}
+
+	// fail early for required build args that are not set
+	if len(p.Build.RequiredArgs) != 0 || p.Build.RequireDeclaredArgs {
+		if err := checkRequiredArgs(p.Build); err != nil {
+			return err
+		}
+	}
+
+	var cmds []buildahCmd
+	// record the buildah version, only streaming the preamble when verbose
+	if p.Preview {
+		cmds = append(cmds, commandVersion())
+	} else if sum.BuildahVersion, err = p.buildahVersion(!p.Verbose); err != nil {
+		return err
+	}
+	if p.MinBuildahVersion != "" && !p.Preview {
+		if err := p.checkVersion(sum.BuildahVersion); err != nil {
+			return err
+		}
+	}
+	if p.Build.SBOM && !p.Preview {
+		if err := checkSBOMSupport(sum.BuildahVersion); err != nil {
+			return err
+		}
+	}
+	if p.Build.SBOM && p.Build.SBOMOutput != "" {
+		if err := prepareSBOMOutput(p.Build.SBOMOutput); err != nil {
+			return err
+		}
+	}
+	if p.Verbose {
+		cmds = append(cmds, commandInfo()) // docker info
+	}
 
 	// pre-pull cache images
-	for _, img := range p.Build.CacheFrom {
-		cmds = append(cmds, commandPull(img))
+	if p.Build.ParallelCachePull {
+		if err := p.run(cmds); err != nil {
+			return err
+		}
+		p.pullParallel(p.Build.cacheFrom())
+		cmds = nil
+	} else {
+		for _, img := range p.Build.cacheFrom() {
+			cmds = append(cmds, ignored(commandCachePull(p.Build, img), "Could not pull cache-from image %s. Ignoring...", img))
+		}
 	}
 
-	cmds = append(cmds, commandBuild(p.Build)) // docker build
+	// scope the cache registry credentials to the cache registries
+	if p.Build.CacheRegistryCreds != "" && len(p.Build.cacheHosts()) != 0 {
+		if p.Build.authFile, err = p.writeCacheAuth(); err != nil {
+			return fmt.Errorf("Error writing cache auth file: %s", err)
+		}
+	}
+
+	// warm the layer cache before the build
+	if len(p.Build.WarmContexts) != 0 {
+		if err := p.run(cmds); err != nil {
+			return err
+		}
+		if err := p.warmCache(); err != nil {
+			return err
+		}
+		cmds = nil
+	}
 
-	for _, tag := range p.Build.Tags {
+	cmds = append(cmds, commandsBuild(p.Build)...) // docker build
+
+	// record the build output to attach it to the pushed image
+	if p.Build.AttachLogs && p.Dryrun == false {
+		if p.buildLog, err = p.openBuildLog(); err != nil {
+			return err
+		}
+		defer p.buildLog.Close()
+	}
+
+	if err := p.run(cmds); err != nil {
+		if p.Build.KeepStages {
+			p.listStages()
+		}
+		return err
+	}
+
+	if err := p.postBuild(); err != nil {
+		return err
+	}
+
+	if p.Build.AnnotationsFile != "" {
+		if err := p.writeAnnotations(p.Build.AnnotationsFile); err != nil {
+			return err
+		}
+	}
+
+	// record the digests of the base images the build used
+	if p.Build.BaseLockFile != "" && !p.Preview {
+		if err := p.writeBaseLock(p.Build.BaseLockFile); err != nil {
+			return err
+		}
+	}
+
+	tags, variants := splitTagArgs(tags, p.Build.TagArgs)
+	variants = append(variants, p.Build.Variants...)
+
+	if p.Build.LoadToDocker {
+		if err := p.loadToDocker(tags); err != nil {
+			return err
+		}
+	}
+
+	// create the repository for registries that do not create it on push
+	if p.Build.CreateRepo && p.Dryrun == false && !p.Preview {
+		for _, repo := range p.Build.repos() {
+			if err := createRepo(p.Login, repo, p.Build.TLSVerify); err != nil {
+				return err
+			}
+		}
+	}
+
+	// push to the staging tag and verify it before publishing
+	if p.Build.StagingTag != "" && p.Dryrun == false {
+		if err := p.stage(p.Build.pushTags(tags)); err != nil {
+			return err
+		}
+	}
+
+	// annotate the manifest list before it is pushed
+	if p.Build.multiPlatform() && p.Build.ManifestAutoAnnotate {
+		annotate := commandManifestAnnotate(p.Build, p.Build.Name, manifestAnnotations(p.Build))
+		if err := p.run([]buildahCmd{annotate}); err != nil {
+			return err
+		}
+	}
+
+	cmds = nil
+	pushed := p.Build.pushTags(tags)
+	sum.Tags = pushed
+
+	// refuse deleting a digest other pushed tags point at
+	if p.Build.ForcePush && p.Dryrun == false {
+		for _, repo := range p.Build.repos() {
+			build := p.Build
+			build.Repo = repo
+			if err := p.checkForcePush(build, pushed); err != nil {
+				return err
+			}
+		}
+	}
+	digests := map[string]string{}
+	for _, tag := range pushed {
 		cmds = append(cmds, commandTag(p.Build, tag)) // docker tag
 
 		if p.Dryrun == false {
-			cmds = append(cmds, commandPush(p.Build, tag)) // docker push
+			if p.Build.forcePush(tag) {
+				fmt.Printf("Force pushing tag %s, deleting it from the registry first\n", tag)
+				cmds = append(cmds, deleteStep(p.Build, p.Build.tagRef(tag)))
+			}
+			if !p.captureDigests() {
+				cmds = append(cmds, p.Build.pushStep(commandPush(p.Build, tag), tag)) // docker push
+				continue
+			}
+			path, err := p.work.writeFile("digest-*", nil)
+			if err != nil {
+				return fmt.Errorf("Error creating digest file: %s", err)
+			}
+			digests[tag] = path
+			cmds = append(cmds, p.Build.pushStep(commandPushDigest(p.Build, tag, path), tag)) // docker push
+		}
+	}
+	cmds = append(cmds, p.fanOut(pushed)...)
+
+	if err := p.run(cmds); err != nil {
+		return err
+	}
+
+	// sign the pushed tags
+	if p.Build.Sign && p.Dryrun == false {
+		if err := p.sign(p.Build.signRefs(pushed)); err != nil {
+			return err
+		}
+	}
+
+	if len(digests) != 0 {
+		refs, digest, err := digestRefs(p.Build, tags, digests)
+		if err != nil {
+			return err
+		}
+		sum.Digest = digest
+		if digest != "" {
+			fmt.Printf("DIGEST=%s\n", digest)
+		}
+		if p.Build.DigestFile != "" {
+			if err := writeDigestFile(p.Build.DigestFile, refs); err != nil {
+				return err
+			}
+		}
+		if p.Build.DeploySnippetFile != "" {
+			if err := writeDeploySnippet(p.Build.DeploySnippetFile, p.Build.DeploySnippetKey, refs); err != nil {
+				return err
+			}
+		}
+		if p.buildLog != nil {
+			if err := p.attachLogs(digest); err != nil {
+				return fmt.Errorf("Error attaching build log: %s", err)
+			}
 		}
 	}
 
+	// copy the pushed tags to the mirror registry, in the background
+	// while the variants build when async
+	var mirrored chan error
+	if p.Mirror.Registry != "" && p.Dryrun == false {
+		if p.MirrorAsync {
+			mirrored = make(chan error, 1)
+			go func() { mirrored <- p.mirror(pushed) }()
+		} else if err := p.mirror(pushed); err != nil {
+			return fmt.Errorf("Error mirroring to %s: %s", p.Mirror.Registry, err)
+		}
+	}
+
+	// build and push the variants
+	for _, variant := range variants {
+		if err := p.buildVariant(variant); err != nil {
+			return fmt.Errorf("Error building variant %s: %s", variant.Tag, err)
+		}
+		sum.Tags = append(sum.Tags, variant.Tag)
+	}
+
+	// build and push the mapped targets to their repositories
+	for _, target := range p.Build.mappedTargets() {
+		if err := p.buildTarget(target, p.Build.TargetMap[target], tags); err != nil {
+			return fmt.Errorf("Error building target %s: %s", target, err)
+		}
+	}
+
+	if mirrored != nil {
+		if err := <-mirrored; err != nil {
+			fmt.Printf("Could not mirror to %s: %s. Ignoring...\n", p.Mirror.Registry, err)
+		}
+	}
+
+	// run the post commands once everything is pushed
+	if p.Dryrun == false {
+		if err := p.postCommands(sum); err != nil {
+			return err
+		}
+	}
+
+	if p.Cleanup || p.Prune {
+		return p.run(p.cleanupCommands(pushed))
+	}
+	return nil
+}
+
+// helper function to create the cleanup commands removing the images
+// tagged for the pushed tags and the built and warm images with
+// Cleanup, and pruning the storage.
+func (p Plugin) cleanupCommands(pushed []string) []buildahCmd {
+	var cmds []buildahCmd
 	if p.Cleanup {
-		cmds = append(cmds, commandRmi(p.Build.Name)) // buildah rmi
+		images := append(p.taggedRefs(pushed), platformImages(p.Build)...)
+		images = append(images, p.Build.Name)
+		images = append(images, p.Build.warmImages()...)
+		if p.buildLog != nil {
+			images = append(images, fmt.Sprintf("%s-logs", p.Build.Name))
+		}
+		for _, image := range images {
+			cmds = append(cmds, rmiStep(p.Build, image)) // buildah rmi
+		}
+	}
+	return append(cmds, ignored(commandPrune(p.Build), "Could not prune the storage. Ignoring...")) // buildah prune
+}
+
+// helper function to run the steps that modify or verify the image
+// after it is built.
+func (p Plugin) postBuild() error {
+	if p.Build.multiPlatform() {
+		fmt.Println("Skipping post build steps for the manifest list")
+		return nil
+	}
+	if p.Preview {
+		fmt.Println("Skipping post build steps in preview mode")
+		return nil
 	}
 
-	// execute all commands in batch mode.
+	// copy labels from the base image
+	if len(p.Build.InheritLabels) != 0 {
+		if err := p.inheritLabels(); err != nil {
+			return err
+		}
+	}
+
+	// set the stop signal and healthcheck
+	if config := runtimeConfig(p.Build); len(config) != 0 {
+		if err := p.recommit(config, false); err != nil {
+			return err
+		}
+	}
+
+	// squash the image when it is larger than the threshold
+	if p.Build.SquashIfLargerThan != "" {
+		if err := p.squashIfLarger(); err != nil {
+			return err
+		}
+	}
+
+	// enforce the image size budget before anything is published
+	if p.Build.MaxImageSize != "" {
+		if err := p.checkImageSize(p.Build.Name, p.Build.MaxImageSize); err != nil {
+			return err
+		}
+	}
+
+	// verify the image entrypoint and cmd
+	if p.Build.AssertEntrypoint != "" || len(p.Build.AssertCmd) != 0 {
+		if err := p.checkEntrypoint(p.Build.Name); err != nil {
+			return err
+		}
+	}
+
+	// run the smoke test against the built image
+	if len(p.Build.SmokeTest) != 0 {
+		if err := p.smokeTest(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// kind of the buildah subcommand a command runs.
+type cmdKind int
+
+const (
+	kindOther cmdKind = iota
+	kindLogin
+	kindLogout
+	kindBuild
+	kindTag
+	kindPush
+	kindPull
+	kindRmi
+	kindPrune
+	kindManifest
+	kindManifestPush
+)
+
+// buildahCmd defines a command, the kind of subcommand it runs and its
+// failure policy in batch mode.
+type buildahCmd struct {
+	*exec.Cmd
+	kind        cmdKind
+	ignoreError bool   // Failure is logged and the batch continues
+	failure     string // Message logged when the failure is ignored
+}
+
+// helper function to create the buildah command of the kind.
+func newCommand(kind cmdKind, args ...string) buildahCmd {
+	return buildahCmd{Cmd: exec.Command(buildahExe, args...), kind: kind}
+}
+
+// helper function to mark the command so its failure is logged with
+// the message and ignored.
+func ignored(cmd buildahCmd, format string, a ...interface{}) buildahCmd {
+	cmd.ignoreError = true
+	cmd.failure = fmt.Sprintf(format, a...)
+	return cmd
+}
+
+// helper function to execute the commands in batch mode, stopping at
+// the first failure of a command that does not ignore errors.
+func (p Plugin) run(cmds []buildahCmd) error {
 	for _, cmd := range cmds {
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		trace(cmd)
-
-		err := cmd.Run()
-		if err != nil && isCommandPull(cmd.Args) {
-			fmt.Printf("Could not pull cache-from image %s. Ignoring...\n", cmd.Args[2])
-		} else if err != nil && isCommandPrune(cmd.Args) {
-			fmt.Printf("Could not prune system containers. Ignoring...\n")
-		} else if err != nil && isCommandRmi(cmd.Args) {
-			fmt.Printf("Could not remove image %s. Ignoring...\n", cmd.Args[2])
+		p.prepare(cmd)
+		stderr := p.out.attach(cmd.Cmd)
+		trace(cmd.Cmd)
+
+		// record the build output for the log artifact
+		if p.buildLog != nil && cmd.kind == kindBuild {
+			cmd.Stdout = io.MultiWriter(cmd.Stdout, p.buildLog)
+			cmd.Stderr = io.MultiWriter(cmd.Stderr, p.buildLog)
+		}
+
+		// tee the build output to count the cache hits
+		var stats *cacheStats
+		if p.Build.ReportCacheStats && cmd.kind == kindBuild {
+			stats = new(cacheStats)
+			cmd.Stdout = io.MultiWriter(cmd.Stdout, stats)
+		}
+
+		// abort the build when the graphroot exceeds its budget
+		var stop func()
+		if p.Build.MaxGraphrootSize != "" && cmd.kind == kindBuild {
+			abort, cancel, err := p.watchGraphroot()
+			if err != nil {
+				return err
+			}
+			p.abort, stop = abort, cancel
+		}
+
+		var err error
+		switch {
+		case p.HandleRateLimits && (cmd.kind == kindPull || cmd.kind == kindBuild):
+			err = p.runRateLimited(cmd.Cmd)
+		case p.Build.PushRetries > 0 && (cmd.kind == kindPush || cmd.kind == kindManifestPush):
+			err = p.runPushRetried(cmd.Cmd)
+		default:
+			err = p.runCmd(cmd.Cmd)
+		}
+		if stop != nil {
+			stop()
+			p.abort = nil
+		}
+		if stats != nil {
+			stats.report()
+		}
+		if err != nil && cmd.ignoreError {
+			fmt.Println(cmd.failure)
 		} else if err != nil {
+			reportCaptured(cmd.Cmd, stderr)
 			return err
 		}
 	}
+	return nil
+}
+
+// helper function to execute a command and capture its standard output.
+func (p Plugin) output(cmd buildahCmd) ([]byte, error) {
+	var stdout bytes.Buffer
+	p.prepare(cmd)
+	stderr := p.out.attach(cmd.Cmd)
+	cmd.Stdout = &stdout
+	trace(cmd.Cmd)
+
+	err := p.runCmd(cmd.Cmd)
+	if err != nil {
+		reportCaptured(cmd.Cmd, stderr)
+	}
+	return stdout.Bytes(), err
+}
+
+// helper function to list the intermediate stage containers and images
+// kept after a failed build.
+func (p Plugin) listStages() {
+	fmt.Println("Build failed. Intermediate stages are kept for debugging with buildah from:")
+	p.run([]buildahCmd{
+		commandContainers(p.Build),
+		commandImages(p.Build),
+	})
+}
 
+// helper function to validate the build parameters.
+func (b Build) validate() error {
+	switch b.CgroupManager {
+	case "", "cgroupfs", "systemd":
+	default:
+		return fmt.Errorf("Invalid cgroup manager %s, must be cgroupfs or systemd", b.CgroupManager)
+	}
+	switch b.Isolation {
+	case "", "oci", "rootless", "chroot":
+	default:
+		return fmt.Errorf("Invalid isolation %s, must be oci, rootless or chroot", b.Isolation)
+	}
+	if b.OmitHistory && b.AddHistory != nil && *b.AddHistory {
+		return fmt.Errorf("Omit history and add history are mutually exclusive")
+	}
+	if b.MountProgram != "" {
+		if b.storageDriver() != "overlay" {
+			return fmt.Errorf("Mount program requires the overlay storage driver, got %s", b.storageDriver())
+		}
+		if _, err := exec.LookPath(b.MountProgram); err != nil {
+			return fmt.Errorf("Error finding mount program: %s", err)
+		}
+	}
+	if b.SeccompProfile != "" {
+		data, err := ioutil.ReadFile(b.SeccompProfile)
+		if err != nil {
+			return fmt.Errorf("Error reading seccomp profile: %s", err)
+		}
+		if !json.Valid(data) {
+			return fmt.Errorf("Invalid seccomp profile %s: not valid JSON", b.SeccompProfile)
+		}
+	}
+	for _, agent := range b.sshAgents() {
+		if err := validateSSHAgent(agent); err != nil {
+			return err
+		}
+	}
+	if err := b.validateTargetMap(); err != nil {
+		return err
+	}
+	for _, repo := range b.CacheTo {
+		if err := validateRepo(repo); err != nil {
+			return fmt.Errorf("Invalid cache-to repository %s: %s", repo, err)
+		}
+	}
+	for _, capability := range append(append([]string{}, b.CapAdd...), b.CapDrop...) {
+		if !capabilityName.MatchString(capability) {
+			return fmt.Errorf("Invalid capability %s, must be an uppercase name like CAP_SYS_ADMIN or SYS_ADMIN", capability)
+		}
+	}
+	for _, volume := range b.Volumes {
+		if parts := strings.SplitN(volume, ":", 3); len(parts) < 2 || parts[0] == "" || parts[1] == "" {
+			return fmt.Errorf("Invalid volume %s, must be source:destination with optional :options", volume)
+		}
+	}
+	if err := validateNetwork(b.Network); err != nil {
+		return err
+	}
+	if b.Sign && b.CosignKey == "" {
+		return fmt.Errorf("Signing requires a cosign key")
+	}
+	if b.SBOM && !sbomScanners[b.sbomScanner()] {
+		return fmt.Errorf("Invalid SBOM scanner %s, must be one of the buildah presets syft, syft-cyclonedx, syft-spdx, trivy, trivy-cyclonedx or trivy-spdx", b.SBOMScanner)
+	}
+	if b.Memory != "" {
+		if _, err := parseSize(b.Memory); err != nil {
+			return fmt.Errorf("Invalid memory limit: %s", err)
+		}
+	}
+	if b.CPUShares < 0 || b.CPUQuota < 0 {
+		return fmt.Errorf("Invalid CPU limits, shares and quota must not be negative")
+	}
+	if b.InlineCache && !b.Layers {
+		return fmt.Errorf("Inline cache requires layer caching to be enabled")
+	}
+	if b.ArgsFile != "" {
+		if _, err := os.Stat(b.ArgsFile); err != nil {
+			return fmt.Errorf("Error reading build args file: %s", err)
+		}
+	}
+	switch b.BasePullPolicy {
+	case "", "always", "missing", "never", "newer":
+	default:
+		return fmt.Errorf("Invalid pull policy %s, must be always, missing, never or newer", b.BasePullPolicy)
+	}
+	if b.ForcePush && len(b.ForcePushTags) == 0 {
+		return fmt.Errorf("Force push requires the tags to overwrite to be confirmed in force_push_tags")
+	}
+	if b.DigestOnly && b.DigestFile == "" {
+		return fmt.Errorf("Digest only push requires a digest file")
+	}
+	if err := b.validatePriority(); err != nil {
+		return err
+	}
+	if b.ContextSizeWarn != "" {
+		if _, err := parseSize(b.ContextSizeWarn); err != nil {
+			return fmt.Errorf("Invalid context size threshold: %s", err)
+		}
+	}
+	if b.MaxImageSize != "" {
+		if _, err := parseSize(b.MaxImageSize); err != nil {
+			return fmt.Errorf("Invalid image size budget: %s", err)
+		}
+	}
+	if len(b.CommandPrefix) != 0 {
+		if _, err := exec.LookPath(b.CommandPrefix[0]); err != nil {
+			return fmt.Errorf("Command prefix %s not found: %s", b.CommandPrefix[0], err)
+		}
+	}
+	if b.MaxGraphrootSize != "" {
+		if _, err := parseSize(b.MaxGraphrootSize); err != nil {
+			return fmt.Errorf("Invalid graphroot size budget: %s", err)
+		}
+	}
+	if b.SquashIfLargerThan != "" {
+		if _, err := parseSize(b.SquashIfLargerThan); err != nil {
+			return fmt.Errorf("Invalid squash threshold: %s", err)
+		}
+	}
 	return nil
 }
 
+// helper function to prepare a buildah command for execution, adding
+// the global flags and the storage configuration. The storage config is
+// scoped to each command through its environment. With BuildOnlyStorage
+// the storage config is not applied to pulls, which use the host default
+// storage instead; images pulled that way are not visible to the build,
+// so cache-from images only warm the host storage. The isolation is set
+// in BUILDAH_ISOLATION, overriding the image default of rootless.
+func (p Plugin) prepare(cmd buildahCmd) {
+	if p.storageConf != "" && !(p.Build.BuildOnlyStorage && cmd.kind == kindPull) {
+		cmd.Env = append(os.Environ(),
+			fmt.Sprintf("CONTAINERS_STORAGE_CONF=%s", p.storageConf),
+			fmt.Sprintf("STORAGE_DRIVER=%s", p.Build.storageDriver()),
+		)
+	}
+	if p.Build.Isolation != "" {
+		if cmd.Env == nil {
+			cmd.Env = os.Environ()
+		}
+		cmd.Env = append(cmd.Env, fmt.Sprintf("BUILDAH_ISOLATION=%s", p.Build.Isolation))
+	}
+	globalFlags(p.Build, cmd.Cmd)
+	commandPrefix(p.Build, cmd.Cmd)
+	if cmd.kind == kindBuild || cmd.kind == kindPush {
+		schedulingPriority(p.Build, cmd.Cmd) // deprioritize builds and pushes
+	}
+}
+
+// environment variables the plugin sets for buildah, which wrappers such
+// as sudo drop from the environment by default.
+var prefixEnv = []string{"CONTAINERS_STORAGE_CONF", "STORAGE_DRIVER", "BUILDAH_ISOLATION", "REGISTRY_AUTH_FILE"}
+
+// helper function to prepend the command prefix, e.g. sudo -n, to a
+// buildah command. The variables in prefixEnv are passed to buildah
+// through env after the prefix, so they survive the sudo env_reset.
+func commandPrefix(build Build, cmd *exec.Cmd) {
+	if len(build.CommandPrefix) == 0 || cmd.Args[0] != buildahExe {
+		return
+	}
+	cmd.Path = build.CommandPrefix[0]
+	if path, err := exec.LookPath(build.CommandPrefix[0]); err == nil {
+		cmd.Path = path
+	}
+	args := append([]string{}, build.CommandPrefix...)
+	if env := prefixValues(cmd); len(env) != 0 {
+		args = append(append(args, "env"), env...)
+	}
+	cmd.Args = append(args, cmd.Args...)
+}
+
+// helper function to return the KEY=VALUE pairs of the prefixEnv
+// variables set for the command, where later entries win like they do
+// for the command itself.
+func prefixValues(cmd *exec.Cmd) []string {
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	values := map[string]string{}
+	for _, kv := range env {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			values[parts[0]] = parts[1]
+		}
+	}
+	var pairs []string
+	for _, key := range prefixEnv {
+		if value := values[key]; value != "" {
+			pairs = append(pairs, fmt.Sprintf("%s=%s", key, value))
+		}
+	}
+	return pairs
+}
+
+// helper function to insert the buildah global flags before the
+// subcommand.
+func globalFlags(build Build, cmd *exec.Cmd) {
+	if cmd.Args[0] != buildahExe {
+		return
+	}
+
+	var flags []string
+	if build.CgroupManager != "" {
+		flags = append(flags, "--cgroup-manager", build.CgroupManager)
+	}
+	if len(flags) == 0 {
+		return
+	}
+
+	args := append([]string{cmd.Args[0]}, flags...)
+	cmd.Args = append(args, cmd.Args[1:]...)
+}
+
+// helper function to compute the tags to push, merging the tags file,
+// the commit sha tag and the tag templates into the configured tags.
+func (p Plugin) tags() ([]string, error) {
+	tags := append([]string{}, p.Build.Tags...)
+	// the version tags replace the configured tags, like the ref based
+	// auto tags do
+	if p.Build.AutoTag && p.Build.Version != "" {
+		generated, err := versionTags(p.Build.Version, p.Build.AutoTagSuffix)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing version %s: %s", p.Build.Version, err)
+		}
+		tags = generated
+	}
+	if p.Build.TagsFile != "" {
+		extra, err := readTagsFile(p.Build.TagsFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading tags file: %s", err)
+		}
+		tags = append(tags, extra...)
+	}
+	if p.Build.TagWithSHA {
+		if sha := shortSHA(p.Build); sha != "" {
+			tags = append(tags, sha)
+		} else {
+			fmt.Println("Could not determine the commit sha. Skipping sha tag...")
+		}
+	}
+	if len(p.Build.TagTemplates) != 0 {
+		extra, err := renderTagTemplates(p.Build.TagTemplates, newTagContext(p.Build, time.Now()))
+		if err != nil {
+			return nil, fmt.Errorf("Error rendering tag templates: %s", err)
+		}
+		tags = append(tags, extra...)
+	}
+	if p.Build.SanitizeTags {
+		tags = SanitizeTags(tags)
+	}
+	for _, tag := range tags {
+		if err := validateTag(tag); err != nil {
+			return nil, err
+		}
+	}
+	return uniqueTags(tags), nil
+}
+
 // helper function to create the docker login command.
-func commandLogin(login Login) *exec.Cmd {
+func commandLogin(login Login) buildahCmd {
 	if login.Email != "" {
 		return commandLoginEmail(login)
 	}
-	return exec.Command(
-		buildahExe, "login",
-		"-u", login.Username,
-		"-p", login.Password,
-		login.Registry,
-	)
+	args := append([]string{"login"}, tlsVerify(login.TLSVerify)...)
+	args = append(args, "-u", login.Username, "-p", login.Password, login.Registry)
+	return newCommand(kindLogin, args...)
 }
 
-// helper to check if args match "docker pull <image>"
-func isCommandPull(args []string) bool {
-	return len(args) > 2 && args[1] == "pull"
+// helper function to return the TLS verification flag for the login,
+// push and pull commands. No flag is passed when it is unset, so the
+// buildah default applies.
+func tlsVerify(verify *bool) []string {
+	if verify == nil {
+		return nil
+	}
+	return []string{fmt.Sprintf("--tls-verify=%t", *verify)}
 }
 
-func commandPull(repo string) *exec.Cmd {
-	return exec.Command(buildahExe, "pull", repo)
+func commandPull(build Build, repo string) buildahCmd {
+	args := append([]string{"pull"}, pullStorageFlags(build)...)
+	args = append(args, tlsVerify(build.TLSVerify)...)
+	return newCommand(kindPull, append(args, repo)...)
 }
 
-func commandLoginEmail(login Login) *exec.Cmd {
-	return exec.Command(
-		buildahExe, "login",
-		"-u", login.Username,
-		"-p", login.Password,
-		"-e", login.Email,
-		login.Registry,
-	)
+// helper function to return the storage driver flags for a pull. With
+// BuildOnlyStorage pulls use the host default storage, so no driver is
+// forced.
+func pullStorageFlags(build Build) []string {
+	if build.BuildOnlyStorage {
+		return nil
+	}
+	return []string{"--storage-driver", build.storageDriver()}
+}
+
+// helper function to create the pull command for a cache-from image,
+// using the cache registry credentials instead of the login. With a
+// base pull policy the cache images already in the store are used as-is,
+// so only the base images are pulled according to the policy.
+func commandCachePull(build Build, image string) buildahCmd {
+	args := append([]string{"pull"}, pullStorageFlags(build)...)
+	args = append(args, tlsVerify(build.TLSVerify)...)
+	if build.BasePullPolicy != "" {
+		args = append(args, "--policy", "missing")
+	}
+	if build.CacheRegistryCreds != "" {
+		args = append(args, "--creds", build.CacheRegistryCreds)
+	}
+	args = append(args, image)
+	return newCommand(kindPull, args...)
+}
+
+func commandLoginEmail(login Login) buildahCmd {
+	args := append([]string{"login"}, tlsVerify(login.TLSVerify)...)
+	args = append(args, "-u", login.Username, "-p", login.Password, "-e", login.Email, login.Registry)
+	return newCommand(kindLogin, args...)
+}
+
+// helper function to create the logout commands for the registries
+// the plugin logged in to.
+func (p Plugin) logoutSteps() []buildahCmd {
+	var steps []buildahCmd
+	for _, login := range []Login{p.Login, p.Mirror} {
+		if login.Password == "" {
+			continue
+		}
+		cmd := commandLogout(login.Registry)
+		steps = append(steps, ignored(cmd, "Could not log out of %s. Ignoring...", cmd.Args[len(cmd.Args)-1]))
+	}
+	return steps
+}
+
+// helper function to create the logout command, defaulting to Docker
+// Hub when no registry is set.
+func commandLogout(registry string) buildahCmd {
+	if registry == "" {
+		registry = "docker.io"
+	}
+	return newCommand(kindLogout, "logout", registry)
 }
 
 // helper function to create the docker info command.
-func commandVersion() *exec.Cmd {
-	return exec.Command(buildahExe, "version")
+func commandVersion() buildahCmd {
+	return newCommand(kindOther, "version")
 }
 
 // helper function to create the docker info command.
-func commandInfo() *exec.Cmd {
-	return exec.Command(buildahExe, "info")
+func commandInfo() buildahCmd {
+	return newCommand(kindOther, "info")
+}
+
+// helper function to create the buildah containers command.
+func commandContainers(build Build) buildahCmd {
+	return newCommand(kindOther, "containers", "--storage-driver", build.storageDriver(), "--all")
+}
+
+// helper function to create the buildah images command.
+func commandImages(build Build) buildahCmd {
+	return newCommand(kindOther, "images", "--storage-driver", build.storageDriver(), "--all")
+}
+
+// helper function to return the cache images in first-seen order,
+// skipping duplicates.
+func (b Build) cacheFrom() []string {
+	return uniqueTags(b.CacheFrom)
+}
+
+// helper function to return the unique cache-to repositories. With the
+// inline cache the layer cache is also pushed to the image repository.
+func (b Build) cacheTo() []string {
+	if b.InlineCache {
+		return uniqueTags(append(append([]string{}, b.CacheTo...), b.Repo))
+	}
+	return uniqueTags(b.CacheTo)
+}
+
+// helper function to return the ssh agents forwarded to the build,
+// adding the host agent with SSHDefault.
+func (b Build) sshAgents() []string {
+	agents := append([]string{}, b.SSHAgents...)
+	if b.SSHDefault {
+		agents = append(agents, "default")
+	}
+	return uniqueTags(agents)
+}
+
+// helper function to check the sockets and keys of an ssh agent entry,
+// given as id[=path[,path...]], exist. An entry without paths forwards
+// the agent at $SSH_AUTH_SOCK.
+func validateSSHAgent(agent string) error {
+	parts := strings.SplitN(agent, "=", 2)
+	if len(parts) == 1 {
+		sock := os.Getenv("SSH_AUTH_SOCK")
+		if sock == "" {
+			return fmt.Errorf("Invalid ssh agent %s: SSH_AUTH_SOCK is not set", agent)
+		}
+		parts = append(parts, sock)
+	}
+	for _, path := range strings.Split(parts[1], ",") {
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("Invalid ssh agent %s: %s does not exist", parts[0], path)
+		}
+	}
+	return nil
+}
+
+// matches a Linux capability name, with or without the CAP_ prefix, or
+// ALL for every capability.
+var capabilityName = regexp.MustCompile(`^(CAP_)?[A-Z][A-Z0-9]*(_[A-Z0-9]+)*$`)
+
+// matches the name of a configured container network.
+var networkName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// helper function to validate the network the RUN steps use. Besides
+// the none, host and private modes and a network namespace path, the
+// name of a configured network is accepted.
+func validateNetwork(network string) error {
+	switch {
+	case network == "", network == "none", network == "host", network == "private":
+	case strings.HasPrefix(network, "ns:"):
+		if !filepath.IsAbs(strings.TrimPrefix(network, "ns:")) {
+			return fmt.Errorf("Invalid network %s, the namespace must be an absolute path", network)
+		}
+	case !networkName.MatchString(network):
+		return fmt.Errorf("Invalid network %s, must be none, host, private, ns:<path> or a network name", network)
+	}
+	return nil
+}
+
+// helper function to render the cache-to template into the repository
+// the layer cache is pushed to. Buildah tags the cache images with the
+// layer cache keys, so the reference must not have a tag.
+func renderCacheTo(build Build, ctx tagContext) (string, error) {
+	rendered, err := renderTagTemplates([]string{build.CacheToTemplate}, ctx)
+	if err != nil {
+		return "", fmt.Errorf("Error rendering cache-to template: %s", err)
+	}
+	if len(rendered) == 0 {
+		return "", fmt.Errorf("Cache-to template %s rendered empty", build.CacheToTemplate)
+	}
+	if err := validateRepo(rendered[0]); err != nil {
+		return "", fmt.Errorf("Invalid cache-to repository %s: %s", rendered[0], err)
+	}
+	return rendered[0], nil
 }
 
 // helper function to create the docker build command.
-func commandBuild(build Build) *exec.Cmd {
+func commandBuild(build Build) buildahCmd {
 	args := []string{
 		"bud",
-		"--storage-driver", "vfs",
-		"-f", build.Dockerfile,
+		"--storage-driver", build.storageDriver(),
+	}
+	if build.Dockerfile != "" {
+		args = append(args, "-f", build.Dockerfile)
 	}
 
-	if build.Squash {
+	if build.SquashAll {
+		args = append(args, "--squash-all")
+	} else if build.Squash {
 		args = append(args, "--squash")
 	}
+	if build.OmitHistory {
+		args = append(args, "--omit-history")
+	}
+	if build.Timestamp != 0 {
+		args = append(args, "--timestamp", strconv.FormatInt(build.Timestamp, 10))
+	}
 	if build.Compress {
 		args = append(args, "--compress")
 	}
-	if build.Pull {
+	if build.BasePullPolicy != "" {
+		args = append(args, "--pull="+build.BasePullPolicy)
+	} else if build.Pull {
 		args = append(args, "--pull=true")
 	}
 	if build.NoCache {
 		args = append(args, "--no-cache")
 	}
-	for _, arg := range build.CacheFrom {
+	cacheFrom := build.cacheFrom()
+	if build.InlineCache && build.Layers {
+		cacheFrom = uniqueTags(append(cacheFrom, build.Repo))
+	}
+	for _, arg := range cacheFrom {
 		args = append(args, "--cache-from", arg)
 	}
+	if build.Layers {
+		for _, repo := range build.cacheTo() {
+			args = append(args, "--cache-to", repo)
+		}
+	}
+	if build.authFile != "" {
+		args = append(args, "--authfile", build.authFile)
+	}
 	for _, arg := range build.ArgsEnv {
 		addProxyValue(&build, arg)
 	}
+	if build.ArgsFile != "" {
+		args = append(args, "--build-arg-file", build.ArgsFile)
+	}
 	for _, arg := range build.Args {
 		args = append(args, "--build-arg", arg)
 	}
 	for _, host := range build.AddHost {
 		args = append(args, "--add-host", host)
 	}
+	for _, capability := range build.CapAdd {
+		args = append(args, "--cap-add", capability)
+	}
+	for _, capability := range build.CapDrop {
+		args = append(args, "--cap-drop", capability)
+	}
+	for _, volume := range build.Volumes {
+		args = append(args, "--volume", volume)
+	}
+	if build.Memory != "" {
+		args = append(args, "--memory", build.Memory)
+	}
+	if build.Network != "" {
+		args = append(args, "--network", build.Network)
+	}
+	if build.SBOM {
+		args = append(args, "--sbom", build.sbomScanner())
+		if build.SBOMOutput != "" {
+			args = append(args, "--sbom-output", build.SBOMOutput)
+		}
+	}
+	if build.CPUShares != 0 {
+		args = append(args, "--cpu-shares", strconv.FormatInt(build.CPUShares, 10))
+	}
+	if build.CPUQuota != 0 {
+		args = append(args, "--cpu-quota", strconv.FormatInt(build.CPUQuota, 10))
+	}
 	if build.Target != "" {
 		args = append(args, "--target", build.Target)
 	}
+	if build.Isolation != "" {
+		args = append(args, "--isolation", build.Isolation)
+	}
 	if build.Quiet {
 		args = append(args, "--quiet")
 	}
+	if build.BuildHostname != "" {
+		args = append(args, "--hostname", build.BuildHostname)
+	}
+	if build.SeccompProfile != "" {
+		args = append(args, "--security-opt", fmt.Sprintf("seccomp=%s", build.SeccompProfile))
+	}
+	for _, agent := range build.sshAgents() {
+		args = append(args, "--ssh", agent)
+	}
+	if build.AddHistory != nil {
+		args = append(args, fmt.Sprintf("--add-history=%t", *build.AddHistory))
+	}
+	if build.KeepStages {
+		if !build.Layers {
+			args = append(args, "--layers=true")
+		}
+		args = append(args, "--rm=false")
+	}
 	if build.Layers {
 		args = append(args, "--layers=true")
 		if build.S3CacheDir != "" {
@@ -259,7 +1459,7 @@ func commandBuild(build Build) *exec.Cmd {
 
 	if build.AutoLabel {
 		labelSchema := []string{
-			fmt.Sprintf("created=%s", time.Now().Format(time.RFC3339)),
+			fmt.Sprintf("created=%s", build.created().Format(time.RFC3339)),
 			fmt.Sprintf("revision=%s", build.Name),
 			fmt.Sprintf("source=%s", build.Remote),
 			fmt.Sprintf("url=%s", build.Link),
@@ -281,16 +1481,23 @@ func commandBuild(build Build) *exec.Cmd {
 		}
 	}
 
+	if build.BuildInfoLabel {
+		args = append(args, "--label", fmt.Sprintf("%s=%s", build.buildInfoKey(), buildInfoLabel(build)))
+	}
+
+	if len(build.Platforms) != 0 {
+		args = append(args, "--platform", strings.Join(build.Platforms, ","))
+	}
 	args = append(args, "-t", build.Name)
 	args = append(args, build.Context)
-	return exec.Command(buildahExe, args...)
+	return newCommand(kindBuild, args...)
 }
 
 // helper function to add proxy values from the environment
 func addProxyBuildArgs(build *Build) {
 	addProxyValue(build, "http_proxy")
 	addProxyValue(build, "https_proxy")
-	addProxyValue(build, "no_proxy")
+	addNoProxyValue(build)
 }
 
 // helper function to add the upper and lower case version of a proxy value.
@@ -303,6 +1510,34 @@ func addProxyValue(build *Build, key string) {
 	}
 }
 
+// helper function to add the upper and lower case version of the
+// no_proxy value, merging the environment value with the no proxy hosts.
+func addNoProxyValue(build *Build) {
+	value := mergeNoProxy(getProxyValue("no_proxy"), build.NoProxyHosts)
+
+	if len(value) > 0 && !hasProxyBuildArg(build, "no_proxy") {
+		build.Args = append(build.Args, fmt.Sprintf("no_proxy=%s", value))
+		build.Args = append(build.Args, fmt.Sprintf("NO_PROXY=%s", value))
+	}
+}
+
+// helper function to merge the comma separated no_proxy value with the
+// hosts, dropping empty and duplicate entries.
+func mergeNoProxy(value string, hosts []string) string {
+	var (
+		merged []string
+		seen   = map[string]bool{}
+	)
+	for _, host := range append(strings.Split(value, ","), hosts...) {
+		host = strings.TrimSpace(host)
+		if host != "" && !seen[host] {
+			merged = append(merged, host)
+			seen[host] = true
+		}
+	}
+	return strings.Join(merged, ",")
+}
+
 // helper function to get a proxy value from the environment.
 //
 // assumes that the upper and lower case versions of are the same.
@@ -329,39 +1564,83 @@ func hasProxyBuildArg(build *Build, key string) bool {
 	return false
 }
 
+// helper function to return the image creation time, which is the
+// build timestamp when set so the created label matches the image.
+func (b Build) created() time.Time {
+	if b.Timestamp != 0 {
+		return time.Unix(b.Timestamp, 0).UTC()
+	}
+	return time.Now()
+}
+
 // helper function to create the docker tag command.
-func commandTag(build Build, tag string) *exec.Cmd {
+func commandTag(build Build, tag string) buildahCmd {
 	var (
 		source = build.Name
-		target = fmt.Sprintf("%s:%s", build.Repo, tag)
+		target = build.tagRef(tag)
 	)
-	return exec.Command(
-		buildahExe, "tag", "--storage-driver", "vfs", source, target,
+	return newCommand(
+		kindTag, "tag", "--storage-driver", build.storageDriver(), source, target,
 	)
 }
 
-// helper function to create the docker push command.
-func commandPush(build Build, tag string) *exec.Cmd {
-	target := fmt.Sprintf("%s:%s", build.Repo, tag)
-	return exec.Command(buildahExe, "push", "--storage-driver", "vfs", target)
+// helper function to create the docker push command. Multi-platform
+// builds push the manifest list with all of its images.
+func commandPush(build Build, tag string) buildahCmd {
+	target := build.tagRef(tag)
+	if build.multiPlatform() {
+		return commandManifestPush(build, target)
+	}
+	args := append([]string{"push", "--storage-driver", build.storageDriver()}, tlsVerify(build.TLSVerify)...)
+	return newCommand(kindPush, append(args, target)...)
 }
 
-// helper to check if args match "docker prune"
-func isCommandPrune(args []string) bool {
-	return len(args) > 3 && args[2] == "prune"
+func commandRmi(build Build, tag string) buildahCmd {
+	return newCommand(kindRmi, "--storage-driver", build.storageDriver(), "rmi", tag)
 }
 
-// helper to check if args match "docker rmi"
-func isCommandRmi(args []string) bool {
-	return len(args) > 2 && args[1] == "rmi"
+// helper function to create the buildah prune command removing the
+// unused images and build cache from the storage.
+func commandPrune(build Build) buildahCmd {
+	return newCommand(kindPrune, "--storage-driver", build.storageDriver(), "prune", "-f")
 }
 
-func commandRmi(tag string) *exec.Cmd {
-	return exec.Command(buildahExe, "--storage-driver", "vfs", "rmi", tag)
+// helper function to create the batch step removing the image, which
+// is ignored when the image does not exist.
+func rmiStep(build Build, tag string) buildahCmd {
+	return ignored(commandRmi(build, tag), "Could not remove image %s. Ignoring...", tag)
+}
+
+// flags whose values are masked in the trace output.
+var secretFlags = map[string]bool{
+	"-p":               true,
+	"--password":       true,
+	"--secret":         true,
+	"--creds":          true,
+	"--decryption-key": true,
+	"--s3-key":         true,
+	"--s3-secret":      true,
 }
 
 // trace writes each command to stdout with the command wrapped in an xml
 // tag so that it can be extracted and displayed in the logs.
 func trace(cmd *exec.Cmd) {
-	fmt.Fprintf(os.Stdout, "+ %s\n", strings.Join(cmd.Args, " "))
+	fmt.Fprintf(os.Stdout, "+ %s\n", strings.Join(redact(cmd.Args), " "))
+}
+
+// helper function to mask the values of sensitive flags, in both the
+// "--flag value" and "--flag=value" forms.
+func redact(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		redacted[i] = arg
+		if i > 0 && secretFlags[args[i-1]] {
+			redacted[i] = "***"
+			continue
+		}
+		if parts := strings.SplitN(arg, "=", 2); len(parts) == 2 && secretFlags[parts[0]] {
+			redacted[i] = parts[0] + "=***"
+		}
+	}
+	return redacted
 }
@@ -1 +1,913 @@
 package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCommandBuildAddHistory(t *testing.T) {
+	enabled, disabled := true, false
+	tests := []struct {
+		AddHistory *bool
+		Want       string
+	}{
+		{nil, ""},
+		{&enabled, "--add-history=true"},
+		{&disabled, "--add-history=false"},
+	}
+
+	for _, test := range tests {
+		cmd := commandBuild(Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", AddHistory: test.AddHistory})
+		if test.Want == "" {
+			if hasArg(cmd.Args, "--add-history=true") || hasArg(cmd.Args, "--add-history=false") {
+				t.Errorf("Unexpected add-history argument in %v", cmd.Args)
+			}
+		} else if !hasArg(cmd.Args, test.Want) {
+			t.Errorf("Expect argument %s in %v", test.Want, cmd.Args)
+		}
+	}
+}
+
+// helper function to check if the argument list contains the argument.
+func hasArg(args []string, arg string) bool {
+	for _, a := range args {
+		if a == arg {
+			return true
+		}
+	}
+	return false
+}
+
+func TestGlobalFlags(t *testing.T) {
+	build := Build{CgroupManager: "cgroupfs"}
+	cmd := commandPush(Build{Repo: "octocat/hello-world"}, "latest")
+	globalFlags(build, cmd.Cmd)
+
+	want := []string{"buildah", "--cgroup-manager", "cgroupfs", "push"}
+	if !reflect.DeepEqual(cmd.Args[:4], want) {
+		t.Errorf("Got arguments %v, want prefix %v", cmd.Args, want)
+	}
+
+	if err := (Build{CgroupManager: "cgroupv2"}).validate(); err == nil {
+		t.Errorf("Expect error for invalid cgroup manager")
+	}
+}
+
+func TestCommandBuildSeccompProfile(t *testing.T) {
+	cmd := commandBuild(Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", SeccompProfile: "/etc/seccomp.json"})
+	if !hasArgs(cmd.Args, "--security-opt", "seccomp=/etc/seccomp.json") {
+		t.Errorf("Expect seccomp security-opt in %v", cmd.Args)
+	}
+
+	f, err := ioutil.TempFile("", "seccomp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"defaultAction": "SCMP_ACT_ERRNO"`)
+	f.Close()
+
+	if err := (Build{SeccompProfile: f.Name()}).validate(); err == nil {
+		t.Errorf("Expect error for invalid seccomp profile")
+	}
+	if err := (Build{SeccompProfile: f.Name() + ".missing"}).validate(); err == nil {
+		t.Errorf("Expect error for missing seccomp profile")
+	}
+}
+
+// helper function to check if the argument list contains the flag
+// followed by the value.
+func hasArgs(args []string, flag, value string) bool {
+	for i := 0; i+1 < len(args); i++ {
+		if args[i] == flag && args[i+1] == value {
+			return true
+		}
+	}
+	return false
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		Args []string
+		Want []string
+	}{
+		{
+			Args: []string{"buildah", "login", "-u", "octocat", "-p", "hunter2", "index.docker.io"},
+			Want: []string{"buildah", "login", "-u", "octocat", "-p", "***", "index.docker.io"},
+		},
+		{
+			Args: []string{"buildah", "login", "--password", "hunter2", "index.docker.io"},
+			Want: []string{"buildah", "login", "--password", "***", "index.docker.io"},
+		},
+		{
+			Args: []string{"buildah", "bud", "--secret", "id=npm,src=.npmrc", "."},
+			Want: []string{"buildah", "bud", "--secret", "***", "."},
+		},
+		{
+			Args: []string{"buildah", "pull", "--creds=octocat:hunter2", "alpine"},
+			Want: []string{"buildah", "pull", "--creds=***", "alpine"},
+		},
+		{
+			Args: []string{"buildah", "pull", "--decryption-key", "key.pem:passphrase", "alpine"},
+			Want: []string{"buildah", "pull", "--decryption-key", "***", "alpine"},
+		},
+		{
+			Args: []string{"buildah", "bud", "--s3-key", "AKIA", "--s3-secret=secret", "."},
+			Want: []string{"buildah", "bud", "--s3-key", "***", "--s3-secret=***", "."},
+		},
+		{
+			Args: []string{"buildah", "push", "octocat/hello-world:latest"},
+			Want: []string{"buildah", "push", "octocat/hello-world:latest"},
+		},
+	}
+	for _, test := range tests {
+		if got := redact(test.Args); !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("Got arguments %v, want %v", got, test.Want)
+		}
+	}
+}
+
+func TestCommandBuildHostname(t *testing.T) {
+	cmd := commandBuild(Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", BuildHostname: "builder"})
+	if !hasArgs(cmd.Args, "--hostname", "builder") {
+		t.Errorf("Expect hostname argument in %v", cmd.Args)
+	}
+
+	cmd = commandBuild(Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: "."})
+	if hasArg(cmd.Args, "--hostname") {
+		t.Errorf("Unexpected hostname argument in %v", cmd.Args)
+	}
+}
+
+func TestPrepareStorageEnv(t *testing.T) {
+	const env = "CONTAINERS_STORAGE_CONF=/home/build/.config/containers/storage.conf"
+	tests := []struct {
+		BuildOnly bool
+		Pull      bool
+		Want      bool
+	}{
+		{BuildOnly: false, Pull: false, Want: true},
+		{BuildOnly: false, Pull: true, Want: true},
+		{BuildOnly: true, Pull: false, Want: true},
+		{BuildOnly: true, Pull: true, Want: false},
+	}
+	for _, test := range tests {
+		p := Plugin{
+			Build:       Build{BuildOnlyStorage: test.BuildOnly},
+			storageConf: "/home/build/.config/containers/storage.conf",
+		}
+		cmd := commandBuild(p.Build)
+		if test.Pull {
+			cmd = commandPull(p.Build, "alpine")
+		}
+		p.prepare(cmd)
+		if got := hasArg(cmd.Env, env); got != test.Want {
+			t.Errorf("Got storage env %v for pull %v with build only storage %v", got, test.Pull, test.BuildOnly)
+		}
+	}
+}
+
+func TestCommandPullStorageDriver(t *testing.T) {
+	cmd := commandPull(Build{StorageDriver: "overlay"}, "alpine")
+	if !hasArgs(cmd.Args, "--storage-driver", "overlay") {
+		t.Errorf("Expect overlay storage driver in %v", cmd.Args)
+	}
+	cmd = commandCachePull(Build{}, "octocat/hello-world:cache")
+	if !hasArgs(cmd.Args, "--storage-driver", "vfs") {
+		t.Errorf("Expect default vfs storage driver in %v", cmd.Args)
+	}
+	cmd = commandCachePull(Build{StorageDriver: "overlay", BuildOnlyStorage: true}, "octocat/hello-world:cache")
+	if hasArg(cmd.Args, "--storage-driver") {
+		t.Errorf("Unexpected storage driver with build only storage in %v", cmd.Args)
+	}
+
+	p := Plugin{Build: Build{StorageDriver: "overlay"}, storageConf: "/tmp/storage.conf"}
+	cmd = commandBuild(p.Build)
+	p.prepare(cmd)
+	if !hasArg(cmd.Env, "STORAGE_DRIVER=overlay") {
+		t.Errorf("Expect STORAGE_DRIVER in the build environment")
+	}
+}
+
+func TestCommandBuildCacheFromUnique(t *testing.T) {
+	build := Build{
+		Name:       "d8dbe4d9",
+		Dockerfile: "Dockerfile",
+		Context:    ".",
+		CacheFrom:  []string{"octocat/hello-world:cache", "alpine", "octocat/hello-world:cache"},
+	}
+	want := []string{"octocat/hello-world:cache", "alpine"}
+	if got := build.cacheFrom(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Got cache images %v, want %v", got, want)
+	}
+
+	cmd := commandBuild(build)
+	var got []string
+	for i := 0; i+1 < len(cmd.Args); i++ {
+		if cmd.Args[i] == "--cache-from" {
+			got = append(got, cmd.Args[i+1])
+		}
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got cache-from arguments %v, want %v", got, want)
+	}
+}
+
+func TestCacheRegistryCreds(t *testing.T) {
+	build := Build{
+		Name:               "d8dbe4d9",
+		Dockerfile:         "Dockerfile",
+		Context:            ".",
+		CacheFrom:          []string{"cache.example.com/hello-world"},
+		CacheRegistryCreds: "octocat:correct-horse",
+	}
+	cmd := commandCachePull(build, "cache.example.com/hello-world")
+	if !hasArgs(cmd.Args, "--creds", "octocat:correct-horse") {
+		t.Errorf("Expect creds argument in %v", cmd.Args)
+	}
+	if got := redact(cmd.Args); hasArg(got, "octocat:correct-horse") {
+		t.Errorf("Expect creds redacted in %v", got)
+	}
+
+	cmd = commandBuild(build)
+	if hasArg(cmd.Args, "--creds") {
+		t.Errorf("Unexpected creds argument for the build in %v", cmd.Args)
+	}
+	build.authFile = "/tmp/auth-cache.json"
+	if cmd = commandBuild(build); !hasArgs(cmd.Args, "--authfile", "/tmp/auth-cache.json") {
+		t.Errorf("Expect the cache auth file in %v", cmd.Args)
+	}
+}
+
+func TestBasePullPolicy(t *testing.T) {
+	build := Build{
+		Name:           "d8dbe4d9",
+		Dockerfile:     "Dockerfile",
+		Context:        ".",
+		Pull:           true,
+		BasePullPolicy: "always",
+		CacheFrom:      []string{"octocat/hello-world:cache"},
+	}
+	cmd := commandBuild(build)
+	if !hasArg(cmd.Args, "--pull=always") || hasArg(cmd.Args, "--pull=true") {
+		t.Errorf("Expect only the base pull policy argument in %v", cmd.Args)
+	}
+
+	cmd = commandCachePull(build, "octocat/hello-world:cache")
+	if !hasArgs(cmd.Args, "--policy", "missing") {
+		t.Errorf("Expect cache image pulled only when missing in %v", cmd.Args)
+	}
+
+	cmd = commandCachePull(Build{}, "octocat/hello-world:cache")
+	if want := []string{buildahExe, "pull", "--storage-driver", "vfs", "octocat/hello-world:cache"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+
+	if err := (Build{BasePullPolicy: "sometimes"}).validate(); err == nil {
+		t.Errorf("Expect error for invalid pull policy")
+	}
+}
+
+func TestCheckForcePush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// skopeo stand-in printing the same manifest for latest and 1.0
+	script := `#!/bin/sh
+case "$3" in
+*:latest|*:1.0) echo '{"config":"a"}' ;;
+*:1.1) echo '{"config":"b"}' ;;
+*) exit 1 ;;
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, "skopeo"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	p := Plugin{out: &outputs{}}
+	build := Build{Repo: "octocat/hello-world", ForcePush: true, ForcePushTags: []string{"latest"}}
+	if err := p.checkForcePush(build, []string{"latest", "1.0"}); err == nil {
+		t.Errorf("Expect error for a force pushed tag sharing its digest")
+	}
+	if err := p.checkForcePush(build, []string{"latest", "1.1", "2.0"}); err != nil {
+		t.Errorf("Unexpected error %s for tags with other digests", err)
+	}
+	if shared := p.sharedDigest(build, "staging", []string{"latest"}); shared != "" {
+		t.Errorf("Got shared tag %s for a missing tag, want none", shared)
+	}
+}
+
+func TestForcePush(t *testing.T) {
+	build := Build{ForcePush: true, ForcePushTags: []string{"latest"}}
+	if !build.forcePush("latest") {
+		t.Errorf("Expect confirmed tag latest force pushed")
+	}
+	if build.forcePush("1.0") {
+		t.Errorf("Unexpected force push of unconfirmed tag 1.0")
+	}
+	if (Build{ForcePushTags: []string{"latest"}}).forcePush("latest") {
+		t.Errorf("Unexpected force push when disabled")
+	}
+	if err := (Build{ForcePush: true}).validate(); err == nil {
+		t.Errorf("Expect error for force push without confirmed tags")
+	}
+
+	disabled := false
+	s := deleteStep(Build{TLSVerify: &disabled}, "octocat/hello-world:latest")
+	if !s.ignoreError {
+		t.Errorf("Expect delete failures ignored")
+	}
+	if !hasArg(s.Args, "--tls-verify=false") {
+		t.Errorf("Expect tls verification disabled in %v", s.Args)
+	}
+	cmd := s.Cmd
+	globalFlags(Build{CgroupManager: "cgroupfs"}, cmd)
+	if hasArg(cmd.Args, "--cgroup-manager") {
+		t.Errorf("Unexpected buildah global flags in %v", cmd.Args)
+	}
+}
+
+func TestCommandBuildPlatforms(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", Platforms: []string{"linux/arm64"}}
+	cmd := commandBuild(build)
+	if !hasArgs(cmd.Args, "--platform", "linux/arm64") || !hasArgs(cmd.Args, "-t", "d8dbe4d9") || hasArg(cmd.Args, "--manifest") {
+		t.Errorf("Expect a single platform image build in %v", cmd.Args)
+	}
+	if cmd := commandPush(build, "latest"); cmd.Args[1] != "push" {
+		t.Errorf("Expect a single platform image push in %v", cmd.Args)
+	}
+
+	build.Platforms = []string{"linux/amd64", "linux/arm64"}
+	build.Repo = "octocat/hello-world"
+	want := []string{buildahExe, "manifest", "push", "--storage-driver", "vfs", "--all", "d8dbe4d9", "docker://octocat/hello-world:latest"}
+	if cmd = commandPush(build, "latest"); !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+
+	cmd = commandBuild(Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: "."})
+	if hasArg(cmd.Args, "--platform") {
+		t.Errorf("Unexpected platform argument in %v", cmd.Args)
+	}
+}
+
+func TestPushRetries(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// fails on the first attempt only
+	script := "test -f " + filepath.Join(dir, "pushed") + " || { touch " + filepath.Join(dir, "pushed") + "; exit 1; }"
+	p := Plugin{Build: Build{PushRetries: 2, PushRetryDelay: time.Millisecond}}
+	if err := p.runPushRetried(exec.Command("sh", "-c", script)); err != nil {
+		t.Errorf("Unexpected error after a retried push: %s", err)
+	}
+	if err := p.runPushRetried(exec.Command("sh", "-c", "exit 1")); err == nil {
+		t.Errorf("Expect error once the retries are exhausted")
+	}
+
+}
+
+func TestLogoutCommands(t *testing.T) {
+	p := Plugin{
+		Login:  Login{Registry: "registry.example.com", Password: "secret"},
+		Mirror: Login{Password: "secret"},
+	}
+	cmds := p.logoutSteps()
+	if len(cmds) != 2 {
+		t.Fatalf("Got %d logout commands, want 2", len(cmds))
+	}
+	if want := []string{buildahExe, "logout", "registry.example.com"}; !reflect.DeepEqual(cmds[0].Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmds[0].Args, want)
+	}
+	if !hasArg(cmds[1].Args, "docker.io") {
+		t.Errorf("Expect the mirror logged out of Docker Hub in %v", cmds[1].Args)
+	}
+	for _, s := range cmds {
+		if !s.ignoreError {
+			t.Errorf("Expect logout failures of %v ignored", s.Args)
+		}
+	}
+	if cmds := (Plugin{Login: Login{Config: "{}"}}).logoutSteps(); len(cmds) != 0 {
+		t.Errorf("Unexpected logout without a login")
+	}
+}
+
+func TestTLSVerify(t *testing.T) {
+	disabled := false
+	build := Build{Name: "d8dbe4d9", Repo: "octocat/hello-world", TLSVerify: &disabled}
+	for _, cmd := range []buildahCmd{
+		commandLogin(Login{Registry: "registry.example.com", TLSVerify: &disabled}),
+		commandPush(build, "latest"),
+		commandPull(build, "alpine"),
+		commandCachePull(build, "octocat/hello-world:cache"),
+	} {
+		if !hasArg(cmd.Args, "--tls-verify=false") {
+			t.Errorf("Expect tls verification disabled in %v", cmd.Args)
+		}
+	}
+
+	build.Platforms = []string{"linux/amd64", "linux/arm64"}
+	if cmd := commandPush(build, "latest"); !hasArg(cmd.Args, "--tls-verify=false") {
+		t.Errorf("Expect tls verification disabled in %v", cmd.Args)
+	}
+
+	build = Build{Name: "d8dbe4d9", Repo: "octocat/hello-world"}
+	for _, cmd := range []buildahCmd{commandLogin(Login{}), commandPush(build, "latest"), commandPull(build, "alpine")} {
+		for _, arg := range cmd.Args {
+			if strings.HasPrefix(arg, "--tls-verify") {
+				t.Errorf("Unexpected tls verification flag in %v", cmd.Args)
+			}
+		}
+	}
+}
+
+func TestCacheTo(t *testing.T) {
+	build := Build{
+		Name:            "d8dbe4d9",
+		Branch:          "main",
+		CacheToTemplate: "registry.example.com/octocat/hello-world/cache-{{.Branch}}",
+	}
+	ctx := newTagContext(build, time.Now())
+	got, err := renderCacheTo(build, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "registry.example.com/octocat/hello-world/cache-main"; got != want {
+		t.Errorf("Got cache-to repository %s, want %s", got, want)
+	}
+
+	for _, tmpl := range []string{"octocat/cache:{{.Branch}}", "octocat/Cache", "{{.Tag}}", "{{.Branch"} {
+		build.CacheToTemplate = tmpl
+		if _, err := renderCacheTo(build, ctx); err == nil {
+			t.Errorf("Expect error for cache-to template %s", tmpl)
+		}
+	}
+
+	build = Build{
+		Name:               "d8dbe4d9",
+		Dockerfile:         "Dockerfile",
+		Context:            ".",
+		Layers:             true,
+		CacheFrom:          []string{"octocat/hello-world/cache"},
+		CacheTo:            []string{"octocat/hello-world/cache", "registry.example.com/octocat/cache", "octocat/hello-world/cache"},
+		CacheRegistryCreds: "octocat:secret",
+	}
+	args := commandBuild(build).Args
+	if !hasArgs(args, "--cache-from", "octocat/hello-world/cache") || !hasArgs(args, "--cache-to", "octocat/hello-world/cache") {
+		t.Errorf("Expect cache-from and cache-to arguments in %v", args)
+	}
+	if !hasArgs(args, "--cache-to", "registry.example.com/octocat/cache") || strings.Count(strings.Join(args, " "), "--cache-to") != 2 {
+		t.Errorf("Expect each cache-to repository once in %v", args)
+	}
+
+	if err := (Build{CacheTo: []string{"octocat/hello-world/cache:latest"}}).validate(); err == nil {
+		t.Errorf("Expect error for a tagged cache-to repository")
+	}
+
+	build.Layers = false
+	if hasArg(commandBuild(build).Args, "--cache-to") {
+		t.Errorf("Unexpected cache-to without layer caching")
+	}
+}
+
+func TestCommandPrefixEnv(t *testing.T) {
+	if path, ok := os.LookupEnv("REGISTRY_AUTH_FILE"); ok {
+		defer os.Setenv("REGISTRY_AUTH_FILE", path)
+	} else {
+		defer os.Unsetenv("REGISTRY_AUTH_FILE")
+	}
+	os.Setenv("REGISTRY_AUTH_FILE", "/tmp/auth.json")
+
+	p := Plugin{Build: Build{CommandPrefix: []string{"sudo", "-n"}, Isolation: "chroot"}, storageConf: "/tmp/storage.conf"}
+	cmd := commandBuild(p.Build)
+	p.prepare(cmd)
+	want := []string{
+		"sudo", "-n", "env",
+		"CONTAINERS_STORAGE_CONF=/tmp/storage.conf",
+		"STORAGE_DRIVER=vfs",
+		"BUILDAH_ISOLATION=chroot",
+		"REGISTRY_AUTH_FILE=/tmp/auth.json",
+		buildahExe,
+	}
+	if !reflect.DeepEqual(cmd.Args[:len(want)], want) {
+		t.Errorf("Got arguments %v, want prefix %v", cmd.Args, want)
+	}
+}
+
+func TestCommandPrefix(t *testing.T) {
+	p := Plugin{Build: Build{CommandPrefix: []string{"sudo", "-n"}, CgroupManager: "cgroupfs", Nice: 10}}
+	cmd := commandPush(p.Build, "latest")
+	args := cmd.Args
+	p.prepare(cmd)
+	want := append([]string{"nice", "-n", "10", "sudo", "-n", buildahExe, "--cgroup-manager", "cgroupfs"}, args[1:]...)
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+
+	cmd = commandDelete(p.Build, "octocat/hello-world:latest")
+	p.prepare(cmd)
+	if hasArg(cmd.Args, "sudo") {
+		t.Errorf("Unexpected command prefix for skopeo in %v", cmd.Args)
+	}
+
+	if err := (Build{CommandPrefix: []string{"/nonexistent/wrapper"}}).validate(); err == nil {
+		t.Errorf("Expect error for a missing command prefix")
+	}
+}
+
+func TestCommandBuildSSH(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	key := filepath.Join(dir, "id_ed25519")
+	if err := ioutil.WriteFile(key, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", SSHAgents: []string{"github=" + key}, SSHDefault: true}
+	args := commandBuild(build).Args
+	if !hasArgs(args, "--ssh", "github="+key) || !hasArgs(args, "--ssh", "default") {
+		t.Errorf("Expect ssh arguments in %v", args)
+	}
+
+	sock := os.Getenv("SSH_AUTH_SOCK")
+	defer os.Setenv("SSH_AUTH_SOCK", sock)
+	os.Setenv("SSH_AUTH_SOCK", key)
+	if err := build.validate(); err != nil {
+		t.Errorf("Unexpected error for existing ssh paths: %s", err)
+	}
+	os.Unsetenv("SSH_AUTH_SOCK")
+	if err := build.validate(); err == nil {
+		t.Errorf("Expect error for the default agent without SSH_AUTH_SOCK")
+	}
+	if err := (Build{SSHAgents: []string{"github=" + filepath.Join(dir, "missing")}}).validate(); err == nil {
+		t.Errorf("Expect error for a missing ssh key")
+	}
+}
+
+func TestCommandPrune(t *testing.T) {
+	cmd := commandPrune(Build{})
+	want := []string{buildahExe, "--storage-driver", "vfs", "prune", "-f"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+}
+
+func TestCommandKinds(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Repo: "octocat/hello-world"}
+	multi := Build{Name: "d8dbe4d9", Repo: "octocat/hello-world", Platforms: []string{"linux/amd64", "linux/arm64"}}
+	tests := []struct {
+		cmd  buildahCmd
+		kind cmdKind
+	}{
+		{commandLogin(Login{Registry: "registry.example.com"}), kindLogin},
+		{commandLogout("registry.example.com"), kindLogout},
+		{commandPull(build, "alpine"), kindPull},
+		{commandCachePull(build, "octocat/hello-world:cache"), kindPull},
+		{commandBuild(build), kindBuild},
+		{commandTag(build, "latest"), kindTag},
+		{commandPush(build, "pull"), kindPush},
+		{commandPushDigest(build, "latest", "digest"), kindPush},
+		{commandPushDaemon(build, "latest"), kindPush},
+		{commandPush(multi, "latest"), kindManifestPush},
+		{commandManifestCreate(build, "d8dbe4d9"), kindManifest},
+		{commandRmi(build, "d8dbe4d9"), kindRmi},
+		{commandPrune(build), kindPrune},
+		{commandInspect(build, "d8dbe4d9"), kindOther},
+		{commandDelete(build, "octocat/hello-world:latest"), kindOther},
+	}
+	for _, test := range tests {
+		if test.cmd.kind != test.kind {
+			t.Errorf("Got kind %d for %v, want %d", test.cmd.kind, test.cmd.Args, test.kind)
+		}
+	}
+}
+
+func TestPushStep(t *testing.T) {
+	build := Build{Repo: "octocat/hello-world"}
+	if s := build.pushStep(commandPush(build, "latest"), "latest"); s.ignoreError {
+		t.Errorf("Unexpected push failure ignored by default")
+	}
+	build.IgnorePushErrors = true
+	s := build.pushStep(commandPush(build, "latest"), "latest")
+	if !s.ignoreError || s.failure != "Could not push octocat/hello-world:latest. Ignoring..." {
+		t.Errorf("Got step ignoring %t with %q, want push failures ignored", s.ignoreError, s.failure)
+	}
+	if s := rmiStep(build, "d8dbe4d9"); !s.ignoreError || !hasArg(s.Args, "rmi") {
+		t.Errorf("Expect rmi failures of %v ignored", s.Args)
+	}
+}
+
+func TestFanOut(t *testing.T) {
+	p := Plugin{Build: Build{Name: "abc", Repo: "octocat/hello-world", Repos: []string{"octocat/hello-world", "harbor.example.com/octocat/hello-world"}}}
+	cmds := p.fanOut([]string{"latest", "ghcr.io/octocat/hello-world:1.0"})
+	var got []string
+	for _, cmd := range cmds {
+		got = append(got, cmd.Args[1]+" "+cmd.Args[len(cmd.Args)-1])
+	}
+	want := []string{"tag harbor.example.com/octocat/hello-world:latest", "push harbor.example.com/octocat/hello-world:latest"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got commands %v, want %v", got, want)
+	}
+
+	p.Dryrun = true
+	if cmds := p.fanOut([]string{"latest"}); len(cmds) != 1 {
+		t.Errorf("Got %d commands, want only the tag without push", len(cmds))
+	}
+	if cmds := (Plugin{Build: Build{Repo: "octocat/hello-world"}}).fanOut([]string{"latest"}); len(cmds) != 0 {
+		t.Errorf("Unexpected commands %v for a single repository", cmds)
+	}
+}
+
+func TestTaggedRefs(t *testing.T) {
+	p := Plugin{
+		Build:  Build{Repo: "octocat/hello-world", Repos: []string{"octocat/hello-world", "harbor.example.com/octocat/hello-world"}, StagingTag: "staging"},
+		Mirror: Login{Registry: "mirror.example.com"},
+	}
+	got := p.taggedRefs([]string{"latest", "ghcr.io/octocat/hello-world:1.0"})
+	want := []string{
+		"octocat/hello-world:latest",
+		"ghcr.io/octocat/hello-world:1.0",
+		"harbor.example.com/octocat/hello-world:latest",
+		"octocat/hello-world:staging",
+		"mirror.example.com/octocat/hello-world:latest",
+		"mirror.example.com/octocat/hello-world:1.0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got refs %v, want %v", got, want)
+	}
+
+	p.Dryrun = true
+	if got := p.taggedRefs([]string{"latest"}); len(got) != 2 {
+		t.Errorf("Got refs %v, want only the repository tags", got)
+	}
+}
+
+func TestNoProxyHosts(t *testing.T) {
+	for _, key := range []string{"no_proxy", "NO_PROXY"} {
+		defer os.Setenv(key, os.Getenv(key))
+		os.Unsetenv(key)
+	}
+
+	os.Setenv("no_proxy", "localhost, .internal,")
+	build := Build{NoProxyHosts: []string{"registry.internal", ".internal", "10.0.0.1"}}
+	addNoProxyValue(&build)
+	want := []string{
+		"no_proxy=localhost,.internal,registry.internal,10.0.0.1",
+		"NO_PROXY=localhost,.internal,registry.internal,10.0.0.1",
+	}
+	if !reflect.DeepEqual(build.Args, want) {
+		t.Errorf("Got build args %v, want %v", build.Args, want)
+	}
+
+	// the no_proxy build arg set by the user is kept
+	build = Build{Args: []string{"no_proxy=example.com"}, NoProxyHosts: []string{"registry.internal"}}
+	addNoProxyValue(&build)
+	if want := []string{"no_proxy=example.com"}; !reflect.DeepEqual(build.Args, want) {
+		t.Errorf("Got build args %v, want %v", build.Args, want)
+	}
+
+	os.Unsetenv("no_proxy")
+	build = Build{NoProxyHosts: []string{"registry.internal"}}
+	addNoProxyValue(&build)
+	if want := []string{"no_proxy=registry.internal", "NO_PROXY=registry.internal"}; !reflect.DeepEqual(build.Args, want) {
+		t.Errorf("Got build args %v, want %v", build.Args, want)
+	}
+	build = Build{}
+	addNoProxyValue(&build)
+	if len(build.Args) != 0 {
+		t.Errorf("Unexpected build args %v without no proxy hosts", build.Args)
+	}
+}
+
+func TestCommandBuildArgsFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "build-args")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# versions\nGO_VERSION=1.13\n\nVERSION=1.0\n")
+	f.Close()
+
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", ArgsFile: f.Name(), Args: []string{"DEBUG=1"}}
+	cmd := commandBuild(build)
+	if !hasArgs(cmd.Args, "--build-arg-file", f.Name()) || !hasArgs(cmd.Args, "--build-arg", "DEBUG=1") {
+		t.Errorf("Expect the build args file and build args in %v", cmd.Args)
+	}
+	if err := build.validate(); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	build.RequiredArgs = []string{"GO_VERSION", "VERSION", "DEBUG"}
+	if err := checkRequiredArgs(build); err != nil {
+		t.Errorf("Unexpected error for required args set in the file: %s", err)
+	}
+
+	build.ArgsFile = f.Name() + ".missing"
+	if err := build.validate(); err == nil || !strings.HasPrefix(err.Error(), "Error reading build args file: ") {
+		t.Errorf("Got error %v, want an error for the missing build args file", err)
+	}
+}
+
+func TestIsolation(t *testing.T) {
+	p := Plugin{Build: Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", Isolation: "chroot"}}
+	cmd := commandBuild(p.Build)
+	p.prepare(cmd)
+	if !hasArgs(cmd.Args, "--isolation", "chroot") {
+		t.Errorf("Expect --isolation chroot in %v", cmd.Args)
+	}
+	if !hasArg(cmd.Env, "BUILDAH_ISOLATION=chroot") {
+		t.Errorf("Expect BUILDAH_ISOLATION=chroot in the command env")
+	}
+
+	cmd = commandBuild(Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: "."})
+	(Plugin{}).prepare(cmd)
+	if hasArg(cmd.Args, "--isolation") || cmd.Env != nil {
+		t.Errorf("Unexpected isolation without the setting in %v", cmd.Args)
+	}
+
+	for _, isolation := range []string{"oci", "rootless", "chroot"} {
+		if err := (Build{Isolation: isolation}).validate(); err != nil {
+			t.Errorf("Unexpected error for isolation %s: %s", isolation, err)
+		}
+	}
+	if err := (Build{Isolation: "vm"}).validate(); err == nil {
+		t.Errorf("Expect error for invalid isolation")
+	}
+}
+
+func TestCommandBuildTimestamp(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", AutoLabel: true, Timestamp: 1577836800}
+	cmd := commandBuild(build)
+	if !hasArgs(cmd.Args, "--timestamp", "1577836800") {
+		t.Errorf("Expect --timestamp in %v", cmd.Args)
+	}
+	if !hasArgs(cmd.Args, "--label", "org.opencontainers.image.created=2020-01-01T00:00:00Z") {
+		t.Errorf("Expect the created label to match the timestamp in %v", cmd.Args)
+	}
+	if got := manifestAnnotations(build)[0]; got != "org.opencontainers.image.created=2020-01-01T00:00:00Z" {
+		t.Errorf("Got annotation %s, want the created annotation to match the timestamp", got)
+	}
+
+	build.Timestamp = 0
+	if cmd := commandBuild(build); hasArg(cmd.Args, "--timestamp") {
+		t.Errorf("Unexpected --timestamp in %v", cmd.Args)
+	}
+}
+
+func TestCommandBuildSquashAll(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", Squash: true}
+	if args := commandBuild(build).Args; !hasArg(args, "--squash") || hasArg(args, "--squash-all") {
+		t.Errorf("Expect only --squash in %v", args)
+	}
+	build.SquashAll = true
+	if args := commandBuild(build).Args; hasArg(args, "--squash") || !hasArg(args, "--squash-all") {
+		t.Errorf("Expect --squash-all preferred over --squash in %v", args)
+	}
+}
+
+func TestCommandBuildOmitHistory(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", SquashAll: true, OmitHistory: true}
+	if args := commandBuild(build).Args; !hasArg(args, "--omit-history") || !hasArg(args, "--squash-all") {
+		t.Errorf("Expect --omit-history with --squash-all in %v", args)
+	}
+	if args := commandCommit(build, "working-container", "d8dbe4d9", true).Args; !hasArg(args, "--omit-history") {
+		t.Errorf("Expect --omit-history in the commit %v", args)
+	}
+	build.OmitHistory = false
+	if args := commandBuild(build).Args; hasArg(args, "--omit-history") {
+		t.Errorf("Unexpected --omit-history in %v", args)
+	}
+}
+
+func TestValidateOmitHistory(t *testing.T) {
+	enabled, disabled := true, false
+	if err := (Build{OmitHistory: true, AddHistory: &enabled}).validate(); err == nil {
+		t.Errorf("Expect error for omit history with add history")
+	}
+	for _, add := range []*bool{nil, &disabled} {
+		if err := (Build{OmitHistory: true, AddHistory: add}).validate(); err != nil {
+			t.Errorf("Unexpected error %s for omit history", err)
+		}
+	}
+}
+
+func TestInlineCache(t *testing.T) {
+	build := Build{
+		Name:        "d8dbe4d9",
+		Dockerfile:  "Dockerfile",
+		Context:     ".",
+		Repo:        "octocat/hello-world",
+		Layers:      true,
+		InlineCache: true,
+		CacheFrom:   []string{"octocat/hello-world"},
+	}
+	args := commandBuild(build).Args
+	if !hasArgs(args, "--cache-to", "octocat/hello-world") || !hasArgs(args, "--cache-from", "octocat/hello-world") {
+		t.Errorf("Expect the image repository as cache-to and cache-from in %v", args)
+	}
+	if n := strings.Count(strings.Join(args, " "), "--cache-from"); n != 1 {
+		t.Errorf("Got %d cache-from arguments, want the repository once", n)
+	}
+	if err := build.validate(); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	build.Layers = false
+	if err := build.validate(); err == nil {
+		t.Errorf("Expect error for inline cache without layer caching")
+	}
+}
+
+func TestCommandBuildCapabilities(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", CapAdd: []string{"CAP_SYS_ADMIN"}, CapDrop: []string{"NET_RAW", "ALL"}}
+	args := commandBuild(build).Args
+	if !hasArgs(args, "--cap-add", "CAP_SYS_ADMIN") || !hasArgs(args, "--cap-drop", "NET_RAW") || !hasArgs(args, "--cap-drop", "ALL") {
+		t.Errorf("Expect the capabilities in %v", args)
+	}
+	if err := build.validate(); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	for _, capability := range []string{"sys_admin", "CAP_", "SYS ADMIN", "--privileged", ""} {
+		if err := (Build{CapAdd: []string{capability}}).validate(); err == nil {
+			t.Errorf("Expect error for capability %q", capability)
+		}
+	}
+}
+
+func TestCommandBuildVolumes(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", Volumes: []string{"/drone/artifacts:/artifacts:ro", "/cache:/root/.cache"}}
+	args := commandBuild(build).Args
+	if !hasArgs(args, "--volume", "/drone/artifacts:/artifacts:ro") || !hasArgs(args, "--volume", "/cache:/root/.cache") {
+		t.Errorf("Expect the volumes in %v", args)
+	}
+	if err := build.validate(); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	for _, volume := range []string{"/drone/artifacts", ":/artifacts", "/drone/artifacts:", ""} {
+		if err := (Build{Volumes: []string{volume}}).validate(); err == nil {
+			t.Errorf("Expect error for volume %q", volume)
+		}
+	}
+}
+
+func TestCommandBuildResourceLimits(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", Memory: "2g", CPUShares: 512, CPUQuota: 50000}
+	args := commandBuild(build).Args
+	if !hasArgs(args, "--memory", "2g") || !hasArgs(args, "--cpu-shares", "512") || !hasArgs(args, "--cpu-quota", "50000") {
+		t.Errorf("Expect the resource limits in %v", args)
+	}
+	if err := build.validate(); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	if args := commandBuild(Build{Name: "d8dbe4d9"}).Args; hasArg(args, "--memory") || hasArg(args, "--cpu-shares") || hasArg(args, "--cpu-quota") {
+		t.Errorf("Unexpected resource limits in %v", args)
+	}
+
+	for _, build := range []Build{{Memory: "2 gigs"}, {CPUShares: -1}, {CPUQuota: -1}} {
+		if err := build.validate(); err == nil {
+			t.Errorf("Expect error for resource limits %s %d %d", build.Memory, build.CPUShares, build.CPUQuota)
+		}
+	}
+}
+
+func TestCommandBuildNetwork(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", Network: "none"}
+	if args := commandBuild(build).Args; !hasArgs(args, "--network", "none") {
+		t.Errorf("Expect --network none in %v", args)
+	}
+	if args := commandBuild(Build{Name: "d8dbe4d9"}).Args; hasArg(args, "--network") {
+		t.Errorf("Unexpected --network in %v", args)
+	}
+
+	for _, network := range []string{"", "none", "host", "private", "ns:/proc/1/ns/net", "build_net-1"} {
+		if err := validateNetwork(network); err != nil {
+			t.Errorf("Unexpected error for network %q: %s", network, err)
+		}
+	}
+	for _, network := range []string{"ns:proc/1/ns/net", "-net", "my network", "host;none"} {
+		if err := validateNetwork(network); err == nil {
+			t.Errorf("Expect error for network %q", network)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// instruction defines a single Dockerfile instruction.
+type instruction struct {
+	Line int    // Line number the instruction starts on
+	Cmd  string // Upper-cased instruction keyword
+	Args string // Raw instruction arguments
+}
+
+// stage defines a single Dockerfile build stage.
+type stage struct {
+	Line int    // Line number of the FROM instruction
+	Base string // Base image or stage the stage builds from
+	Name string // Stage name, if any
+}
+
+// known Dockerfile instruction keywords.
+var instructions = map[string]bool{
+	"ADD":         true,
+	"ARG":         true,
+	"CMD":         true,
+	"COPY":        true,
+	"ENTRYPOINT":  true,
+	"ENV":         true,
+	"EXPOSE":      true,
+	"FROM":        true,
+	"HEALTHCHECK": true,
+	"LABEL":       true,
+	"MAINTAINER":  true,
+	"ONBUILD":     true,
+	"RUN":         true,
+	"SHELL":       true,
+	"STOPSIGNAL":  true,
+	"USER":        true,
+	"VOLUME":      true,
+	"WORKDIR":     true,
+}
+
+// matches the heredoc delimiters of an instruction, e.g. RUN <<EOF
+var heredoc = regexp.MustCompile(`<<-?["']?([A-Za-z0-9_]+)["']?`)
+
+// helper function to default the Dockerfile to the Dockerfile inside
+// the build context, matching docker. Remote contexts are left to
+// buildah, which applies the same default.
+func defaultDockerfile(build Build) (string, error) {
+	if build.Dockerfile != "" || isRemoteContext(build.Context) {
+		return build.Dockerfile, nil
+	}
+	path := filepath.Join(build.Context, "Dockerfile")
+	if _, err := os.Stat(path); err != nil {
+		return "", fmt.Errorf("No Dockerfile specified and %s does not exist", path)
+	}
+	return path, nil
+}
+
+// helper function to report whether the Dockerfile is an http(s) URL.
+func isRemoteDockerfile(dockerfile string) bool {
+	return strings.HasPrefix(dockerfile, "http://") || strings.HasPrefix(dockerfile, "https://")
+}
+
+// helper function to download the Dockerfile from its URL, or read it
+// from stdin when it is -, into a work file. The build and the checks
+// reading the Dockerfile use the local copy, which is removed with the
+// work directory after the run.
+func (p Plugin) fetchDockerfile() (string, error) {
+	var (
+		data []byte
+		err  error
+	)
+	if p.Build.Dockerfile == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = downloadDockerfile(p.Build.Dockerfile)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Error reading Dockerfile %s: %s", p.Build.Dockerfile, err)
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return "", fmt.Errorf("Error reading Dockerfile %s: no content", p.Build.Dockerfile)
+	}
+	path, err := p.work.writeFile("Dockerfile-*", data)
+	if err != nil {
+		return "", fmt.Errorf("Error writing Dockerfile: %s", err)
+	}
+	return path, nil
+}
+
+// helper function to download the Dockerfile, failing unless the
+// server responds with 200 OK.
+func downloadDockerfile(url string) ([]byte, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	res, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// helper function to read and parse a Dockerfile from disk.
+func readDockerfile(path string) ([]instruction, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseDockerfile(f)
+}
+
+// helper function to split a Dockerfile into instructions, joining
+// continuation lines and skipping comments and heredoc bodies.
+func parseDockerfile(r io.Reader) ([]instruction, error) {
+	var (
+		list    []instruction
+		current *instruction
+		lineno  int
+	)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+
+		if current == nil && (line == "" || strings.HasPrefix(line, "#")) {
+			continue
+		}
+		if current != nil && strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		continued := strings.HasSuffix(line, "\\")
+		line = strings.TrimSuffix(line, "\\")
+
+		if current == nil {
+			parts := strings.SplitN(line, " ", 2)
+			current = &instruction{
+				Line: lineno,
+				Cmd:  strings.ToUpper(strings.TrimSpace(parts[0])),
+			}
+			if len(parts) == 2 {
+				current.Args = strings.TrimSpace(parts[1])
+			}
+		} else if line != "" {
+			current.Args = strings.TrimSpace(current.Args + " " + line)
+		}
+
+		if continued {
+			continue
+		}
+
+		// skip over the body of any heredocs
+		for _, match := range heredoc.FindAllStringSubmatch(current.Args, -1) {
+			for scanner.Scan() {
+				lineno++
+				if strings.TrimSpace(scanner.Text()) == match[1] {
+					break
+				}
+			}
+		}
+
+		list = append(list, *current)
+		current = nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if current != nil {
+		return list, fmt.Errorf("line %d: unterminated line continuation", current.Line)
+	}
+	return list, nil
+}
+
+// helper function to split the instructions into build stages,
+// expanding build args in the base image references. The args are
+// KEY=VALUE pairs that override the ARG defaults declared before the
+// first FROM instruction.
+func parseStages(list []instruction, args []string) []stage {
+	values := map[string]string{}
+	var stages []stage
+	for _, inst := range list {
+		switch {
+		case inst.Cmd == "ARG" && len(stages) == 0:
+			parts := strings.SplitN(inst.Args, "=", 2)
+			if len(parts) == 2 {
+				values[parts[0]] = strings.Trim(parts[1], `"'`)
+			}
+		case inst.Cmd == "FROM":
+			if len(stages) == 0 {
+				for _, arg := range args {
+					if parts := strings.SplitN(arg, "=", 2); len(parts) == 2 {
+						values[parts[0]] = parts[1]
+					}
+				}
+			}
+			var fields []string
+			for _, field := range strings.Fields(inst.Args) {
+				if !strings.HasPrefix(field, "--") {
+					fields = append(fields, field)
+				}
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			st := stage{
+				Line: inst.Line,
+				Base: os.Expand(fields[0], func(key string) string { return values[key] }),
+			}
+			if len(fields) == 3 && strings.EqualFold(fields[1], "AS") {
+				st.Name = fields[2]
+			}
+			stages = append(stages, st)
+		}
+	}
+	return stages
+}
+
+// helper function to resolve the base image of the target stage,
+// following stages that build from earlier stages.
+func baseImage(stages []stage, target string) string {
+	if len(stages) == 0 {
+		return ""
+	}
+	current := stages[len(stages)-1]
+	for _, st := range stages {
+		if target != "" && st.Name == target {
+			current = st
+			break
+		}
+	}
+	for i := len(stages) - 1; i >= 0; i-- {
+		if stages[i].Name != "" && stages[i].Name == current.Base && stages[i].Line < current.Line {
+			current = stages[i]
+		}
+	}
+	return current.Base
+}
+
+// helper function to collect the ARG names each stage declares, keyed
+// by the stage name.
+func declaredArgs(list []instruction) map[string]map[string]bool {
+	declared := map[string]map[string]bool{}
+	var current map[string]bool
+	for _, inst := range list {
+		switch inst.Cmd {
+		case "FROM":
+			current = map[string]bool{}
+			if st := parseStages([]instruction{inst}, nil); len(st) != 0 && st[0].Name != "" {
+				declared[st[0].Name] = current
+			}
+		case "ARG":
+			if current == nil || inst.Args == "" {
+				continue
+			}
+			current[strings.SplitN(inst.Args, "=", 2)[0]] = true
+		}
+	}
+	return declared
+}
+
+// helper function to return the stage args as build args, in stage
+// name order. Buildah applies each build arg to every stage that
+// declares it, so a warning is printed for args set on a stage that
+// does not declare them.
+func stageArgs(build Build) ([]string, error) {
+	list, err := readDockerfile(build.Dockerfile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading %s: %s", build.Dockerfile, err)
+	}
+	declared := declaredArgs(list)
+
+	var names []string
+	for name := range build.StageArgs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var args []string
+	for _, name := range names {
+		args = append(args, build.StageArgs[name]...)
+		stage, ok := declared[name]
+		if !ok {
+			fmt.Printf("Warning: build args set for unknown stage %s\n", name)
+			continue
+		}
+		for _, arg := range build.StageArgs[name] {
+			if key := strings.SplitN(arg, "=", 2)[0]; !stage[key] {
+				fmt.Printf("Warning: build arg %s is set for stage %s, which does not declare it\n", key, name)
+			}
+		}
+	}
+	return args, nil
+}
+
+// build args buildah sets automatically for every build.
+var predefinedArgs = map[string]bool{
+	"BUILDPLATFORM":  true,
+	"BUILDOS":        true,
+	"BUILDARCH":      true,
+	"BUILDVARIANT":   true,
+	"TARGETPLATFORM": true,
+	"TARGETOS":       true,
+	"TARGETARCH":     true,
+	"TARGETVARIANT":  true,
+}
+
+// helper function to collect the names of the ARG instructions that
+// declare no default value, including the args declared before the
+// first FROM instruction.
+func undefaultedArgs(list []instruction) []string {
+	var names []string
+	seen := map[string]bool{}
+	for _, inst := range list {
+		if inst.Cmd != "ARG" || inst.Args == "" || strings.Contains(inst.Args, "=") {
+			continue
+		}
+		if name := inst.Args; !seen[name] && !predefinedArgs[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// helper function to check the required build args are set, failing
+// with the list of missing args. With RequireDeclaredArgs every arg the
+// Dockerfile declares without a default is required too.
+func checkRequiredArgs(build Build) error {
+	required := append([]string{}, build.RequiredArgs...)
+	if build.RequireDeclaredArgs {
+		list, err := readDockerfile(build.Dockerfile)
+		if err != nil {
+			return fmt.Errorf("Error reading %s: %s", build.Dockerfile, err)
+		}
+		required = append(required, undefaultedArgs(list)...)
+	}
+
+	set := map[string]bool{}
+	for _, arg := range build.Args {
+		set[strings.SplitN(arg, "=", 2)[0]] = true
+	}
+	for _, arg := range build.ArgsEnv {
+		if getProxyValue(arg) != "" {
+			set[arg] = true
+		}
+	}
+	if build.ArgsFile != "" {
+		names, err := argsFileNames(build.ArgsFile)
+		if err != nil {
+			return fmt.Errorf("Error reading build args file: %s", err)
+		}
+		for _, name := range names {
+			set[name] = true
+		}
+	}
+
+	var missing []string
+	for _, name := range uniqueTags(required) {
+		if !set[name] {
+			missing = append(missing, name)
+		}
+	}
+	if len(missing) != 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("Missing required build args: %s", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// helper function to check every base image is pinned by digest,
+// skipping stages that build from earlier stages and the base images
+// in the allowlist. Allowlist entries match the image reference or its
+// repository without the tag.
+func checkPinnedBase(build Build) error {
+	list, err := readDockerfile(build.Dockerfile)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", build.Dockerfile, err)
+	}
+
+	allowed := map[string]bool{"scratch": true}
+	for _, image := range build.PinnedBaseAllowlist {
+		allowed[image] = true
+	}
+	names := map[string]bool{}
+	for _, st := range parseStages(list, build.Args) {
+		repo := st.Base
+		if i := strings.LastIndex(repo, ":"); i > strings.LastIndex(repo, "/") {
+			repo = repo[:i]
+		}
+		switch {
+		case names[st.Base], allowed[st.Base], allowed[repo]:
+		case !strings.Contains(st.Base, "@sha256:"):
+			return fmt.Errorf("line %d: base image %s is not pinned by digest", st.Line, st.Base)
+		}
+		if st.Name != "" {
+			names[st.Name] = true
+		}
+	}
+	return nil
+}
+
+// helper function to check a Dockerfile for obvious syntax errors
+// without invoking the build. buildah has no parse-only mode and a bud
+// run would execute the RUN instructions, so the builtin linter reuses
+// the Dockerfile parser of the other pre-build checks instead.
+func lintDockerfile(path string) error {
+	list, err := readDockerfile(path)
+	if err != nil {
+		return err
+	}
+
+	var from bool
+	for _, inst := range list {
+		if !instructions[inst.Cmd] {
+			return fmt.Errorf("line %d: unknown instruction %s", inst.Line, inst.Cmd)
+		}
+		if inst.Args == "" {
+			return fmt.Errorf("line %d: %s requires at least one argument", inst.Line, inst.Cmd)
+		}
+		if inst.Cmd == "FROM" {
+			from = true
+		} else if !from && inst.Cmd != "ARG" {
+			return fmt.Errorf("line %d: %s before the first FROM instruction", inst.Line, inst.Cmd)
+		}
+	}
+	if !from {
+		return fmt.Errorf("no FROM instruction found")
+	}
+	return nil
+}
+
+// helper function to lint the Dockerfile with the configured linter.
+// An external linter runs like the buildah commands, with the command
+// timeout, the output capture and the trace.
+func (p Plugin) lint() error {
+	build := p.Build
+	linter := build.Linter
+	if linter == "hadolint" {
+		if _, err := exec.LookPath(linter); err != nil {
+			fmt.Println("Could not find hadolint. Falling back to builtin linter...")
+			linter = ""
+		}
+	}
+
+	if linter == "" || linter == "builtin" {
+		fmt.Printf("Linting %s with the builtin linter\n", build.Dockerfile)
+		if err := lintDockerfile(build.Dockerfile); err != nil {
+			return fmt.Errorf("Error linting %s: %s", build.Dockerfile, err)
+		}
+		return nil
+	}
+
+	if err := p.run([]buildahCmd{commandLint(linter, build.Dockerfile)}); err != nil {
+		return fmt.Errorf("Error linting %s: %s", build.Dockerfile, err)
+	}
+	return nil
+}
+
+// helper function to create an external linter command.
+func commandLint(linter, dockerfile string) buildahCmd {
+	return buildahCmd{Cmd: exec.Command(linter, dockerfile), kind: kindOther}
+}
+
+// helper function to read the names of the build args set in the build
+// args file, skipping blank lines and comments.
+func argsFileNames(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var names []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		names = append(names, strings.SplitN(line, "=", 2)[0])
+	}
+	return names, scanner.Err()
+}
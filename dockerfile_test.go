@@ -0,0 +1,341 @@
+package docker
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDockerfile(t *testing.T) {
+	dockerfile := `# syntax=docker/dockerfile:1
+ARG VERSION=1
+FROM golang:1.13 AS build
+
+# build the binary
+RUN go build \
+    -o /bin/app \
+    ./cmd/app
+RUN <<EOF
+echo FROM inside a heredoc
+EOF
+FROM scratch
+COPY --from=build /bin/app /bin/app
+`
+	got, err := parseDockerfile(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []instruction{
+		{Line: 2, Cmd: "ARG", Args: "VERSION=1"},
+		{Line: 3, Cmd: "FROM", Args: "golang:1.13 AS build"},
+		{Line: 6, Cmd: "RUN", Args: "go build -o /bin/app ./cmd/app"},
+		{Line: 9, Cmd: "RUN", Args: "<<EOF"},
+		{Line: 12, Cmd: "FROM", Args: "scratch"},
+		{Line: 13, Cmd: "COPY", Args: "--from=build /bin/app /bin/app"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got instructions %v, want %v", got, want)
+	}
+}
+
+func TestLintDockerfile(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		err        string
+	}{
+		{
+			name:       "valid",
+			dockerfile: "ARG BASE=alpine\nFROM $BASE\nRUN true\n",
+		},
+		{
+			name:       "unknown instruction",
+			dockerfile: "FROM alpine\nRNU true\n",
+			err:        "line 2: unknown instruction RNU",
+		},
+		{
+			name:       "missing arguments",
+			dockerfile: "FROM alpine\nWORKDIR\n",
+			err:        "line 2: WORKDIR requires at least one argument",
+		},
+		{
+			name:       "instruction before from",
+			dockerfile: "RUN true\nFROM alpine\n",
+			err:        "line 1: RUN before the first FROM instruction",
+		},
+		{
+			name:       "missing from",
+			dockerfile: "ARG BASE=alpine\n",
+			err:        "no FROM instruction found",
+		},
+		{
+			name:       "unterminated continuation",
+			dockerfile: "FROM alpine\nRUN true \\\n",
+			err:        "line 2: unterminated line continuation",
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range tests {
+		path := filepath.Join(dir, "Dockerfile")
+		if err := ioutil.WriteFile(path, []byte(test.dockerfile), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := lintDockerfile(path)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %s", test.name, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%s: got error %v, want %s", test.name, err, test.err)
+		}
+	}
+}
+
+func TestLintExternal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	linter := filepath.Join(dir, "linter")
+	if err := ioutil.WriteFile(linter, []byte("#!/bin/sh\nexec sleep 10\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if cmd := commandLint(linter, "Dockerfile"); !reflect.DeepEqual(cmd.Args, []string{linter, "Dockerfile"}) {
+		t.Errorf("Got lint command %v", cmd.Args)
+	}
+
+	// the external linter runs with the command timeout
+	p := Plugin{Build: Build{Linter: linter, Dockerfile: "Dockerfile", CommandTimeout: 50 * time.Millisecond}}
+	err = p.lint()
+	if err == nil || !strings.Contains(err.Error(), "Command timeout after 50ms") {
+		t.Errorf("Got error %v, want the linter killed at the command timeout", err)
+	}
+}
+
+func TestBaseImage(t *testing.T) {
+	dockerfile := `ARG GO_VERSION=1.12
+FROM --platform=$BUILDPLATFORM golang:${GO_VERSION} AS build
+FROM alpine:3.10 AS base
+FROM base AS release
+FROM build AS test
+`
+	list, err := parseDockerfile(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stages := parseStages(list, []string{"GO_VERSION=1.13"})
+	if got := stages[0]; got.Base != "golang:1.13" || got.Name != "build" {
+		t.Errorf("Got stage %v, want golang:1.13 named build", got)
+	}
+
+	tests := map[string]string{
+		"":        "golang:1.13",
+		"release": "alpine:3.10",
+		"base":    "alpine:3.10",
+	}
+	for target, want := range tests {
+		if got := baseImage(stages, target); got != want {
+			t.Errorf("Got base image %s for target %q, want %s", got, target, want)
+		}
+	}
+}
+
+func TestDeclaredArgs(t *testing.T) {
+	dockerfile := `ARG GO_VERSION=1.13
+FROM golang:${GO_VERSION} AS build
+ARG VERSION
+ARG LDFLAGS="-s -w"
+FROM alpine AS release
+ARG TZ=UTC
+FROM release
+ARG DEBUG
+`
+	list, err := parseDockerfile(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := declaredArgs(list)
+	want := map[string]map[string]bool{
+		"build":   {"VERSION": true, "LDFLAGS": true},
+		"release": {"TZ": true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got declared args %v, want %v", got, want)
+	}
+}
+
+func TestDefaultDockerfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if _, err := defaultDockerfile(Build{Context: dir}); err == nil {
+		t.Errorf("Expect error when the default Dockerfile does not exist")
+	}
+
+	path := filepath.Join(dir, "Dockerfile")
+	if err := ioutil.WriteFile(path, []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := defaultDockerfile(Build{Context: dir}); err != nil || got != path {
+		t.Errorf("Got Dockerfile %s, %v, want %s", got, err, path)
+	}
+	if got, _ := defaultDockerfile(Build{Context: dir, Dockerfile: "build/Dockerfile"}); got != "build/Dockerfile" {
+		t.Errorf("Got Dockerfile %s, want the configured Dockerfile", got)
+	}
+	if got, err := defaultDockerfile(Build{Context: "https://github.com/octocat/hello-world.git"}); err != nil || got != "" {
+		t.Errorf("Got Dockerfile %s, %v, want the remote context default", got, err)
+	}
+}
+
+func TestFetchDockerfile(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/Dockerfile":
+			w.Write([]byte("FROM alpine\n"))
+		case "/empty":
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	p := Plugin{work: &workdir{}}
+	defer p.work.cleanup()
+
+	p.Build.Dockerfile = server.URL + "/Dockerfile"
+	path, err := p.fetchDockerfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "FROM alpine\n" {
+		t.Errorf("Got Dockerfile %q, want the downloaded content", data)
+	}
+
+	tests := map[string]string{
+		"/missing": "unexpected status 404 Not Found",
+		"/empty":   "no content",
+	}
+	for url, want := range tests {
+		p.Build.Dockerfile = server.URL + url
+		if _, err := p.fetchDockerfile(); err == nil || !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("Got error %v for %s, want %s", err, url, want)
+		}
+	}
+
+	if !isRemoteDockerfile("https://example.com/Dockerfile") || isRemoteDockerfile("build/Dockerfile") {
+		t.Errorf("Unexpected remote Dockerfile detection")
+	}
+}
+
+func TestCheckPinnedBase(t *testing.T) {
+	tests := []struct {
+		name       string
+		dockerfile string
+		allowlist  []string
+		err        string
+	}{
+		{
+			name:       "pinned",
+			dockerfile: "FROM golang:1.13@sha256:4e8f1a AS build\nFROM build AS test\nFROM scratch\n",
+		},
+		{
+			name:       "unpinned stage",
+			dockerfile: "FROM golang:1.13@sha256:4e8f1a AS build\nFROM alpine:3.10\n",
+			err:        "line 2: base image alpine:3.10 is not pinned by digest",
+		},
+		{
+			name:       "unpinned build arg",
+			dockerfile: "ARG BASE=alpine:3.10\nFROM $BASE AS base\n",
+			err:        "line 2: base image alpine:3.10 is not pinned by digest",
+		},
+		{
+			name:       "allowlisted",
+			dockerfile: "FROM alpine:3.10\nFROM registry.example.com:5000/base:1.0\n",
+			allowlist:  []string{"alpine", "registry.example.com:5000/base:1.0"},
+		},
+	}
+
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, test := range tests {
+		path := filepath.Join(dir, "Dockerfile")
+		if err := ioutil.WriteFile(path, []byte(test.dockerfile), 0644); err != nil {
+			t.Fatal(err)
+		}
+		err := checkPinnedBase(Build{Dockerfile: path, PinnedBaseAllowlist: test.allowlist})
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %s", test.name, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%s: got error %v, want %s", test.name, err, test.err)
+		}
+	}
+}
+
+func TestCheckRequiredArgs(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "Dockerfile")
+	dockerfile := "ARG GO_VERSION\nFROM golang:${GO_VERSION}\nARG TARGETARCH\nARG VERSION\nARG TZ=UTC\n"
+	if err := ioutil.WriteFile(path, []byte(dockerfile), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		build Build
+		err   string
+	}{
+		{
+			name:  "set",
+			build: Build{Args: []string{"VERSION=1.0"}, RequiredArgs: []string{"VERSION"}},
+		},
+		{
+			name:  "missing",
+			build: Build{Args: []string{"TZ=UTC"}, RequiredArgs: []string{"VERSION", "COMMIT", "VERSION"}},
+			err:   "Missing required build args: COMMIT, VERSION",
+		},
+		{
+			name:  "declared",
+			build: Build{Dockerfile: path, Args: []string{"VERSION=1.0"}, RequireDeclaredArgs: true},
+			err:   "Missing required build args: GO_VERSION",
+		},
+		{
+			name:  "declared set",
+			build: Build{Dockerfile: path, Args: []string{"GO_VERSION=1.13", "VERSION=1.0"}, RequireDeclaredArgs: true},
+		},
+	}
+	for _, test := range tests {
+		err := checkRequiredArgs(test.build)
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %s", test.name, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%s: got error %v, want %s", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,46 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// helper function to run the post commands after all pushes succeed
+// and before the cleanup, so they can still use the local image. The
+// commands run in order and a failure fails the step unless
+// PostCommandsContinueOnError is set.
+func (p Plugin) postCommands(sum *summary) error {
+	for _, command := range p.Build.PostCommands {
+		if len(command) == 0 {
+			continue
+		}
+		cmd := commandPost(command, sum)
+		stderr := p.out.attach(cmd)
+		trace(cmd)
+		err := p.runCmd(cmd)
+		if err == nil {
+			continue
+		}
+		reportCaptured(cmd, stderr)
+		if !p.Build.PostCommandsContinueOnError {
+			return fmt.Errorf("Error running post command %s: %s", command[0], err)
+		}
+		fmt.Printf("Could not run post command %s. Ignoring...\n", command[0])
+	}
+	return nil
+}
+
+// helper function to create a post command. The pushed repository,
+// tags and digest are exposed in the PUSHED_REPO, PUSHED_TAGS and
+// PUSHED_DIGEST environment variables.
+func commandPost(command []string, sum *summary) *exec.Cmd {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(),
+		fmt.Sprintf("PUSHED_REPO=%s", sum.Repo),
+		fmt.Sprintf("PUSHED_TAGS=%s", strings.Join(sum.Tags, ",")),
+		fmt.Sprintf("PUSHED_DIGEST=%s", sum.Digest),
+	)
+	return cmd
+}
@@ -0,0 +1,35 @@
+package docker
+
+import (
+	"os/exec"
+	"testing"
+)
+
+func Test_commandPost(t *testing.T) {
+	sum := &summary{Repo: "octocat/hello-world", Tags: []string{"latest", "1.0"}, Digest: "sha256:3b2a7c9e"}
+	cmd := commandPost([]string{"deploy", "--env", "staging"}, sum)
+	for _, env := range []string{
+		"PUSHED_REPO=octocat/hello-world",
+		"PUSHED_TAGS=latest,1.0",
+		"PUSHED_DIGEST=sha256:3b2a7c9e",
+	} {
+		if !hasArg(cmd.Env, env) {
+			t.Errorf("Expect %s in the post command environment", env)
+		}
+	}
+}
+
+func Test_postCommands(t *testing.T) {
+	if _, err := exec.LookPath("false"); err != nil {
+		t.Skip("false not found")
+	}
+	p := Plugin{Build: Build{PostCommands: [][]string{{"false"}}}}
+	if err := p.postCommands(&summary{}); err == nil {
+		t.Errorf("Expect a failing post command to fail the step")
+	}
+
+	p.Build.PostCommandsContinueOnError = true
+	if err := p.postCommands(&summary{}); err != nil {
+		t.Errorf("Unexpected error with continue on error: %s", err)
+	}
+}
@@ -0,0 +1,190 @@
+package docker
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+type (
+	// imageInfo defines the subset of the buildah inspect output used
+	// by the plugin.
+	imageInfo struct {
+		FromImage       string      `json:"FromImage"`
+		FromImageDigest string      `json:"FromImageDigest"`
+		Manifest        string      `json:"Manifest"`
+		OCIv1           imageConfig `json:"OCIv1"`
+	}
+
+	// imageConfig defines the OCI image configuration.
+	imageConfig struct {
+		Config struct {
+			Entrypoint []string          `json:"Entrypoint"`
+			Cmd        []string          `json:"Cmd"`
+			Labels     map[string]string `json:"Labels"`
+		} `json:"config"`
+	}
+
+	// imageManifest defines the subset of the OCI manifest used to
+	// compute the image size.
+	imageManifest struct {
+		Config struct {
+			Size int64 `json:"size"`
+		} `json:"config"`
+		Layers []struct {
+			Size int64 `json:"size"`
+		} `json:"layers"`
+		Annotations map[string]string `json:"annotations"`
+	}
+
+	// imageAnnotations defines the labels and annotations written to
+	// the annotations file.
+	imageAnnotations struct {
+		Labels      map[string]string `json:"labels"`
+		Annotations map[string]string `json:"annotations"`
+	}
+)
+
+// helper function to compute the image size from the manifest.
+func (i *imageInfo) size() (int64, error) {
+	var manifest imageManifest
+	if err := json.Unmarshal([]byte(i.Manifest), &manifest); err != nil {
+		return 0, fmt.Errorf("Error parsing image manifest: %s", err)
+	}
+	size := manifest.Config.Size
+	for _, layer := range manifest.Layers {
+		size += layer.Size
+	}
+	return size, nil
+}
+
+// helper function to write the labels and annotations of the built
+// image to a JSON file, replacing any previous contents. The labels
+// include the auto-labels, the user labels and any labels inherited
+// from the base image. A manifest list is not an image, so for a
+// multi-platform build the first platform image is inspected; every
+// platform is built from the same Dockerfile and labels.
+func (p Plugin) writeAnnotations(path string) error {
+	name := p.Build.Name
+	if images := platformImages(p.Build); len(images) != 0 {
+		name = images[0]
+	}
+	info, err := p.inspect(name)
+	if err != nil {
+		return err
+	}
+	var manifest imageManifest
+	if err := json.Unmarshal([]byte(info.Manifest), &manifest); err != nil {
+		return fmt.Errorf("Error parsing image manifest: %s", err)
+	}
+
+	out := imageAnnotations{
+		Labels:      info.OCIv1.Config.Labels,
+		Annotations: manifest.Annotations,
+	}
+	if out.Labels == nil {
+		out.Labels = map[string]string{}
+	}
+	if out.Annotations == nil {
+		out.Annotations = map[string]string{}
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("Error writing annotations file: %s", err)
+	}
+
+	fmt.Printf("Annotations written to %s\n", path)
+	return nil
+}
+
+// helper function to fail when the image size exceeds the budget.
+func (p Plugin) checkImageSize(name, budget string) error {
+	limit, err := parseSize(budget)
+	if err != nil {
+		return err
+	}
+	info, err := p.inspect(name)
+	if err != nil {
+		return err
+	}
+	size, err := info.size()
+	if err != nil {
+		return err
+	}
+
+	if size > limit {
+		return fmt.Errorf("Image %s is %s, exceeding the size budget of %s", name, formatSize(size), formatSize(limit))
+	}
+	fmt.Printf("Image %s is %s, within the size budget of %s\n", name, formatSize(size), formatSize(limit))
+	return nil
+}
+
+// helper function to fail when the entrypoint or cmd of the image do
+// not match the expected values.
+func (p Plugin) checkEntrypoint(name string) error {
+	info, err := p.inspect(name)
+	if err != nil {
+		return err
+	}
+	config := info.OCIv1.Config
+
+	if p.Build.AssertEntrypoint != "" {
+		want, err := parseCommand(p.Build.AssertEntrypoint)
+		if err != nil {
+			return fmt.Errorf("Invalid entrypoint assertion: %s", err)
+		}
+		if !equalCommand(config.Entrypoint, want) {
+			return fmt.Errorf("Image %s has entrypoint %q, expected %q", name, config.Entrypoint, want)
+		}
+	}
+	if len(p.Build.AssertCmd) != 0 && !equalCommand(config.Cmd, p.Build.AssertCmd) {
+		return fmt.Errorf("Image %s has cmd %q, expected %q", name, config.Cmd, p.Build.AssertCmd)
+	}
+	return nil
+}
+
+// helper function to parse a command given either as a JSON array or
+// as whitespace separated words.
+func parseCommand(s string) ([]string, error) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "[") {
+		return strings.Fields(s), nil
+	}
+	var command []string
+	err := json.Unmarshal([]byte(s), &command)
+	return command, err
+}
+
+// helper function to compare two commands.
+func equalCommand(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// helper function to inspect an image in local storage.
+func (p Plugin) inspect(name string) (*imageInfo, error) {
+	out, err := p.output(commandInspect(p.Build, name))
+	if err != nil {
+		return nil, fmt.Errorf("Error inspecting image %s: %s", name, err)
+	}
+	info := new(imageInfo)
+	if err := json.Unmarshal(out, info); err != nil {
+		return nil, fmt.Errorf("Error parsing inspect output for %s: %s", name, err)
+	}
+	return info, nil
+}
+
+// helper function to create the buildah inspect command.
+func commandInspect(build Build, name string) buildahCmd {
+	return newCommand(kindOther, "inspect", "--storage-driver", build.storageDriver(), "--type", "image", name)
+}
@@ -0,0 +1,84 @@
+package docker
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_imageInfoSize(t *testing.T) {
+	info := &imageInfo{
+		Manifest: `{"config":{"size":1024},"layers":[{"size":2048},{"size":4096}]}`,
+	}
+	got, err := info.size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != 7168 {
+		t.Errorf("Got size %d, want 7168", got)
+	}
+}
+
+func Test_parseCommand(t *testing.T) {
+	tests := map[string][]string{
+		`["/bin/app", "--config", "/etc/app.yml"]`: {"/bin/app", "--config", "/etc/app.yml"},
+		"/bin/app --config /etc/app.yml":           {"/bin/app", "--config", "/etc/app.yml"},
+	}
+	for s, want := range tests {
+		got, err := parseCommand(s)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if !equalCommand(got, want) {
+			t.Errorf("Got command %q, want %q", got, want)
+		}
+	}
+}
+
+func TestWriteAnnotationsMultiPlatform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// buildah stand-in inspecting the platform images only, as the
+	// manifest list is not an image
+	script := `#!/bin/sh
+case "$*" in
+*" d8dbe4d9-linux-amd64") echo '{"OCIv1":{"config":{"Labels":{"version":"1.0"}}},"Manifest":"{\\"annotations\\":{\\"source\\":\\"git\\"}}"}' ;;
+*) exit 1 ;;
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, buildahExe), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	// the parent directory is created like the other output files
+	path := filepath.Join(dir, "out", "annotations.json")
+	p := Plugin{Build: Build{Name: "d8dbe4d9", Platforms: []string{"linux/amd64", "linux/arm64"}}, out: &outputs{}}
+	if err := p.writeAnnotations(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got imageAnnotations
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := imageAnnotations{
+		Labels:      map[string]string{"version": "1.0"},
+		Annotations: map[string]string{"source": "git"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got annotations %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,47 @@
+package docker
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// helper function to read the key=value labels of the labels file,
+// skipping blank lines and comments.
+func readLabelsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		labels []string
+		lineno int
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineno++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" {
+			return nil, fmt.Errorf("line %d: expected key=value, got %q", lineno, line)
+		}
+		labels = append(labels, fmt.Sprintf("%s=%s", strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])))
+	}
+	return labels, scanner.Err()
+}
+
+// helper function to merge the labels of the labels file with the
+// inline labels, which take precedence for the same key.
+func (b Build) mergeLabelsFile() ([]string, error) {
+	labels, err := readLabelsFile(b.LabelsFile)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading labels file %s: %s", b.LabelsFile, err)
+	}
+	return mergeArgs(labels, b.Labels), nil
+}
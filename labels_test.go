@@ -0,0 +1,44 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMergeLabelsFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "labels.properties")
+	data := "# image labels\norg.opencontainers.image.vendor = Octocat\n\norg.opencontainers.image.licenses=MIT\nteam=platform=core\n"
+	if err := ioutil.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	build := Build{LabelsFile: path, Labels: []string{"org.opencontainers.image.licenses=Apache-2.0"}}
+	got, err := build.mergeLabelsFile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"org.opencontainers.image.vendor=Octocat",
+		"team=platform=core",
+		"org.opencontainers.image.licenses=Apache-2.0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got labels %v, want %v", got, want)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("vendor=Octocat\n# comment\nlicenses\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := build.mergeLabelsFile(); err == nil || !strings.Contains(err.Error(), `line 3: expected key=value, got "licenses"`) {
+		t.Errorf("Got error %v, want the malformed line reported", err)
+	}
+}
@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// helper function to report whether the build targets more than one
+// platform and produces a manifest list instead of an image.
+func (b Build) multiPlatform() bool {
+	return len(b.Platforms) > 1
+}
+
+// helper function to return the names of the per-platform images of a
+// multi-platform build, e.g. Name-linux-arm64.
+func platformImages(build Build) []string {
+	if !build.multiPlatform() {
+		return nil
+	}
+	var images []string
+	for _, platform := range build.Platforms {
+		images = append(images, fmt.Sprintf("%s-%s", build.Name, strings.Replace(platform, "/", "-", -1)))
+	}
+	return images
+}
+
+// helper function to create the build commands. Multi-platform builds
+// build an image per platform, then create a manifest list named after
+// the build and add each platform image to it. Any list left from a
+// previous run is removed first.
+func commandsBuild(build Build) []buildahCmd {
+	if !build.multiPlatform() {
+		return []buildahCmd{commandBuild(build)}
+	}
+
+	var cmds []buildahCmd
+	images := platformImages(build)
+	for i, platform := range build.Platforms {
+		pb := build
+		pb.Name = images[i]
+		pb.Platforms = []string{platform}
+		cmds = append(cmds, commandBuild(pb))
+	}
+	cmds = append(cmds, rmiStep(build, build.Name))
+	cmds = append(cmds, commandManifestCreate(build, build.Name))
+	for _, image := range images {
+		cmds = append(cmds, commandManifestAdd(build, build.Name, image))
+	}
+	return cmds
+}
+
+// helper function to create the OCI annotations describing the image
+// index, mirroring the auto-labels of single images. Annotations whose
+// source values are unavailable are skipped.
+func manifestAnnotations(build Build) []string {
+	const prefix = "org.opencontainers.image"
+	values := []struct {
+		key, value string
+	}{
+		{"created", build.created().Format(time.RFC3339)},
+		{"revision", build.Name},
+		{"source", build.Remote},
+		{"url", build.Link},
+	}
+
+	var annotations []string
+	for _, v := range values {
+		if v.value != "" {
+			annotations = append(annotations, fmt.Sprintf("%s.%s=%s", prefix, v.key, v.value))
+		}
+	}
+	return annotations
+}
+
+// helper function to create the buildah manifest annotate command
+// annotating the image index itself.
+func commandManifestAnnotate(build Build, list string, annotations []string) buildahCmd {
+	args := []string{"manifest", "annotate", "--storage-driver", build.storageDriver(), "--index"}
+	for _, annotation := range annotations {
+		args = append(args, "--annotation", annotation)
+	}
+	args = append(args, list)
+	return newCommand(kindManifest, args...)
+}
+
+// helper function to create the buildah manifest create command.
+func commandManifestCreate(build Build, list string) buildahCmd {
+	return newCommand(kindManifest, "manifest", "create", "--storage-driver", build.storageDriver(), list)
+}
+
+// helper function to create the buildah manifest add command adding a
+// local image to the manifest list.
+func commandManifestAdd(build Build, list, image string) buildahCmd {
+	return newCommand(
+		kindManifest, "manifest", "add", "--storage-driver", build.storageDriver(),
+		list, fmt.Sprintf("containers-storage:%s", image),
+	)
+}
+
+// helper function to create the buildah manifest push command pushing
+// the manifest list and all of its images to the target.
+func commandManifestPush(build Build, target string) buildahCmd {
+	args := append([]string{"manifest", "push", "--storage-driver", build.storageDriver()}, tlsVerify(build.TLSVerify)...)
+	args = append(args, "--all", build.Name, fmt.Sprintf("docker://%s", target))
+	return newCommand(kindManifestPush, args...)
+}
@@ -0,0 +1,65 @@
+package docker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_manifestAnnotations(t *testing.T) {
+	got := manifestAnnotations(Build{Name: "d8dbe4d9", Remote: "https://github.com/octocat/hello-world.git"})
+	if len(got) != 3 || !strings.HasPrefix(got[0], "org.opencontainers.image.created=") {
+		t.Fatalf("Got annotations %v, want created, revision and source", got)
+	}
+	want := []string{
+		"org.opencontainers.image.revision=d8dbe4d9",
+		"org.opencontainers.image.source=https://github.com/octocat/hello-world.git",
+	}
+	if !reflect.DeepEqual(got[1:], want) {
+		t.Errorf("Got annotations %v, want %v", got[1:], want)
+	}
+}
+
+func Test_commandManifestAnnotate(t *testing.T) {
+	cmd := commandManifestAnnotate(Build{}, "octocat/hello-world:latest", []string{"org.opencontainers.image.revision=d8dbe4d9"})
+	want := []string{
+		buildahExe, "manifest", "annotate", "--storage-driver", "vfs", "--index",
+		"--annotation", "org.opencontainers.image.revision=d8dbe4d9",
+		"octocat/hello-world:latest",
+	}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+}
+
+func Test_commandsBuild(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", Platforms: []string{"linux/amd64", "linux/arm64"}}
+	cmds := commandsBuild(build)
+	if len(cmds) != 6 {
+		t.Fatalf("Got %d commands, want 6", len(cmds))
+	}
+	if !hasArgs(cmds[0].Args, "--platform", "linux/amd64") || !hasArgs(cmds[0].Args, "-t", "d8dbe4d9-linux-amd64") {
+		t.Errorf("Expect the amd64 image build in %v", cmds[0].Args)
+	}
+	if !hasArgs(cmds[1].Args, "--platform", "linux/arm64") || !hasArgs(cmds[1].Args, "-t", "d8dbe4d9-linux-arm64") {
+		t.Errorf("Expect the arm64 image build in %v", cmds[1].Args)
+	}
+	if !cmds[2].ignoreError || !hasArg(cmds[2].Args, "rmi") {
+		t.Errorf("Expect the previous manifest list removed with %v", cmds[2].Args)
+	}
+	want := [][]string{
+		{buildahExe, "manifest", "create", "--storage-driver", "vfs", "d8dbe4d9"},
+		{buildahExe, "manifest", "add", "--storage-driver", "vfs", "d8dbe4d9", "containers-storage:d8dbe4d9-linux-amd64"},
+		{buildahExe, "manifest", "add", "--storage-driver", "vfs", "d8dbe4d9", "containers-storage:d8dbe4d9-linux-arm64"},
+	}
+	for i, args := range want {
+		if got := cmds[i+3].Args; !reflect.DeepEqual(got, args) {
+			t.Errorf("Got arguments %v, want %v", got, args)
+		}
+	}
+
+	build.Platforms = []string{"linux/arm64"}
+	if cmds := commandsBuild(build); len(cmds) != 1 || !hasArgs(cmds[0].Args, "-t", "d8dbe4d9") {
+		t.Errorf("Expect a single image build for one platform")
+	}
+}
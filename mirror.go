@@ -0,0 +1,43 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// helper function to tag and push the image to the mirror registry,
+// logging in with the mirror credentials first.
+func (p Plugin) mirror(tags []string) error {
+	if p.Mirror.Password != "" {
+		cmd := commandLogin(p.Mirror)
+		p.prepare(cmd)
+		stderr := p.out.attach(cmd.Cmd)
+		if err := p.runCmd(cmd.Cmd); err != nil {
+			reportCaptured(cmd.Cmd, stderr)
+			return fmt.Errorf("Error authenticating: %s", err)
+		}
+	}
+
+	build := p.Build
+	build.Repo = mirrorRepo(p.Build.Repo, p.Mirror.Registry)
+
+	var cmds []buildahCmd
+	for _, tag := range tags {
+		if isImageRef(tag) {
+			tag = mirrorRepo(tag, p.Mirror.Registry)
+		}
+		cmds = append(cmds, commandTag(build, tag))
+		cmds = append(cmds, commandPush(build, tag))
+	}
+	return p.run(cmds)
+}
+
+// helper function to rewrite the repository to the mirror registry,
+// replacing the registry host of the repository if it has one.
+func mirrorRepo(repo, registry string) string {
+	parts := strings.SplitN(repo, "/", 2)
+	if len(parts) == 2 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		repo = parts[1]
+	}
+	return fmt.Sprintf("%s/%s", strings.TrimSuffix(registry, "/"), repo)
+}
@@ -0,0 +1,21 @@
+package docker
+
+import "testing"
+
+func Test_mirrorRepo(t *testing.T) {
+	tests := []struct {
+		Repo string
+		Want string
+	}{
+		{Repo: "octocat/hello-world", Want: "backup.example.com/octocat/hello-world"},
+		{Repo: "index.docker.io/octocat/hello-world", Want: "backup.example.com/octocat/hello-world"},
+		{Repo: "localhost:5000/hello-world", Want: "backup.example.com/hello-world"},
+		{Repo: "localhost/hello-world", Want: "backup.example.com/hello-world"},
+		{Repo: "hello-world", Want: "backup.example.com/hello-world"},
+	}
+	for _, test := range tests {
+		if got := mirrorRepo(test.Repo, "backup.example.com/"); got != test.Want {
+			t.Errorf("Got mirror repo %s for %s, want %s", got, test.Repo, test.Want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+)
+
+// outputs defines where the command output is written. Output streams
+// to the console unless captured, in which case it is written to the
+// capture file or buffered for the summary.
+type outputs struct {
+	stdout io.Writer
+	stderr io.Writer
+	buffer struct{ stdout, stderr bytes.Buffer }
+	files  []*os.File
+}
+
+// helper function to create the command outputs for the plugin.
+func newOutputs(p Plugin) (*outputs, error) {
+	out := new(outputs)
+	var err error
+	if out.stdout, err = out.open(p.CaptureStdout, p.StdoutFile, os.Stdout, &out.buffer.stdout); err != nil {
+		return nil, err
+	}
+	if out.stderr, err = out.open(p.CaptureStderr, p.StderrFile, os.Stderr, &out.buffer.stderr); err != nil {
+		out.close()
+		return nil, err
+	}
+	return out, nil
+}
+
+// helper function to open the destination of a single output stream.
+func (o *outputs) open(capture bool, path string, console io.Writer, buf *bytes.Buffer) (io.Writer, error) {
+	if !capture {
+		return console, nil
+	}
+	if path == "" {
+		return &syncWriter{w: buf}, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating output file: %s", err)
+	}
+	o.files = append(o.files, f)
+	return &syncWriter{w: f}, nil
+}
+
+// syncWriter defines a writer safe for commands running concurrently,
+// such as the async mirror push.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// helper function to attach the outputs to the command. Captured
+// stderr is also kept per command, so a failing command can still
+// report its errors on the console. It returns that buffer, or nil when
+// stderr streams to the console.
+func (o *outputs) attach(cmd *exec.Cmd) *bytes.Buffer {
+	if o == nil {
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		return nil
+	}
+	cmd.Stdout = o.stdout
+	if o.stderr == os.Stderr {
+		cmd.Stderr = o.stderr
+		return nil
+	}
+	buf := new(bytes.Buffer)
+	cmd.Stderr = io.MultiWriter(o.stderr, buf)
+	return buf
+}
+
+// helper function to close the capture files.
+func (o *outputs) close() {
+	if o == nil {
+		return
+	}
+	for _, f := range o.files {
+		f.Close()
+	}
+}
+
+// helper function to report the captured stderr of a failed command
+// on the console.
+func reportCaptured(cmd *exec.Cmd, stderr *bytes.Buffer) {
+	if stderr == nil || stderr.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Error output of %s:\n%s", strings.Join(redact(cmd.Args), " "), stderr.String())
+}
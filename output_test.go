@@ -0,0 +1,49 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func Test_outputs(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not found")
+	}
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "stderr.log")
+	out, err := newOutputs(Plugin{CaptureStdout: true, CaptureStderr: true, StderrFile: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command("sh", "-c", "echo built; echo failed >&2; exit 1")
+	stderr := out.attach(cmd)
+	if err := cmd.Run(); err == nil {
+		t.Fatal("Expect the command to fail")
+	}
+	out.close()
+
+	if got := out.buffer.stdout.String(); got != "built\n" {
+		t.Errorf("Got captured output %q, want %q", got, "built\n")
+	}
+	if stderr == nil || stderr.String() != "failed\n" {
+		t.Errorf("Expect the command errors kept for reporting, got %v", stderr)
+	}
+	if data, _ := ioutil.ReadFile(path); string(data) != "failed\n" {
+		t.Errorf("Got captured errors %q, want %q", data, "failed\n")
+	}
+
+	out, _ = newOutputs(Plugin{})
+	cmd = exec.Command("true")
+	if stderr := out.attach(cmd); stderr != nil || cmd.Stdout != os.Stdout || cmd.Stderr != os.Stderr {
+		t.Errorf("Expect output streamed to the console by default")
+	}
+}
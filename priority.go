@@ -0,0 +1,87 @@
+package docker
+
+import (
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// io scheduling classes accepted by ionice.
+var ioniceClasses = map[string]string{
+	"realtime":    "1",
+	"best-effort": "2",
+	"idle":        "3",
+	"1":           "1",
+	"2":           "2",
+	"3":           "3",
+}
+
+// helper function to parse the io priority, given as class[:level],
+// into the ionice arguments.
+func parseIONice(s string) ([]string, error) {
+	parts := strings.SplitN(s, ":", 2)
+	class, ok := ioniceClasses[parts[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown class %s, must be realtime, best-effort or idle", parts[0])
+	}
+	args := []string{"-c", class}
+	if len(parts) == 2 {
+		if class == "3" {
+			return nil, fmt.Errorf("the idle class does not take a level")
+		}
+		level, err := strconv.Atoi(parts[1])
+		if err != nil || level < 0 || level > 7 {
+			return nil, fmt.Errorf("level %s must be between 0 and 7", parts[1])
+		}
+		args = append(args, "-n", parts[1])
+	}
+	return args, nil
+}
+
+// helper function to validate the scheduling priority.
+func (b Build) validatePriority() error {
+	if b.Nice < -20 || b.Nice > 19 {
+		return fmt.Errorf("Invalid nice value %d, must be between -20 and 19", b.Nice)
+	}
+	if b.Nice != 0 {
+		if _, err := exec.LookPath("nice"); err != nil {
+			return fmt.Errorf("Error finding nice: %s", err)
+		}
+	}
+	if b.IONice != "" {
+		if _, err := parseIONice(b.IONice); err != nil {
+			return fmt.Errorf("Invalid io priority %s: %s", b.IONice, err)
+		}
+		if _, err := exec.LookPath("ionice"); err != nil {
+			return fmt.Errorf("Error finding ionice: %s", err)
+		}
+	}
+	return nil
+}
+
+// helper function to launch the command through nice and ionice with
+// the configured scheduling priority. It must be applied after the
+// global flags, which are only added to buildah itself.
+func schedulingPriority(build Build, cmd *exec.Cmd) {
+	var wrapper []string
+	if build.IONice != "" {
+		args, err := parseIONice(build.IONice)
+		if err != nil {
+			return
+		}
+		wrapper = append(append(wrapper, "ionice"), args...)
+	}
+	if build.Nice != 0 {
+		wrapper = append(wrapper, "nice", "-n", strconv.Itoa(build.Nice))
+	}
+	if len(wrapper) == 0 {
+		return
+	}
+
+	cmd.Path = wrapper[0]
+	if path, err := exec.LookPath(wrapper[0]); err == nil {
+		cmd.Path = path
+	}
+	cmd.Args = append(wrapper, cmd.Args...)
+}
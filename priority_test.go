@@ -0,0 +1,51 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_parseIONice(t *testing.T) {
+	tests := []struct {
+		IONice string
+		Want   []string
+		Err    bool
+	}{
+		{IONice: "idle", Want: []string{"-c", "3"}},
+		{IONice: "best-effort:7", Want: []string{"-c", "2", "-n", "7"}},
+		{IONice: "2:4", Want: []string{"-c", "2", "-n", "4"}},
+		{IONice: "idle:1", Err: true},
+		{IONice: "best-effort:8", Err: true},
+		{IONice: "lazy", Err: true},
+	}
+	for _, test := range tests {
+		got, err := parseIONice(test.IONice)
+		if test.Err != (err != nil) {
+			t.Errorf("Got error %v for %s, want error %v", err, test.IONice, test.Err)
+		}
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("Got arguments %v for %s, want %v", got, test.IONice, test.Want)
+		}
+	}
+}
+
+func TestPrepareSchedulingPriority(t *testing.T) {
+	p := Plugin{Build: Build{Nice: 10, IONice: "idle"}}
+
+	cmd := commandPush(Build{Repo: "octocat/hello-world"}, "latest")
+	p.prepare(cmd)
+	want := []string{"ionice", "-c", "3", "nice", "-n", "10", buildahExe, "push", "--storage-driver", "vfs", "octocat/hello-world:latest"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+
+	cmd = commandInfo()
+	p.prepare(cmd)
+	if want := []string{buildahExe, "info"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+
+	if err := (Build{Nice: 20}).validatePriority(); err == nil {
+		t.Errorf("Expect error for out of range nice value")
+	}
+}
@@ -0,0 +1,26 @@
+//go:build !windows
+// +build !windows
+
+package docker
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// helper function to start the command in its own process group so a
+// timeout kills the processes it spawned along with it.
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+// helper function to kill the process group of the command, falling
+// back to the command process alone.
+func killProcessGroup(cmd *exec.Cmd) {
+	if err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL); err != nil {
+		cmd.Process.Kill()
+	}
+}
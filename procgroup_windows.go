@@ -0,0 +1,12 @@
+package docker
+
+import "os/exec"
+
+// helper function to start the command in its own process group. Not
+// supported on windows.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// helper function to kill the command process.
+func killProcessGroup(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
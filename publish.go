@@ -0,0 +1,230 @@
+package docker
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"os/exec"
+	"time"
+)
+
+// helper function to push the image to the staging tag and run the
+// verification command against it. When verification fails the staging
+// tag is optionally deleted and an error is returned, so the final tags
+// are never pushed. The staging tag is kept when one of the tags shares
+// its digest, since the delete would remove that tag too.
+func (p Plugin) stage(tags []string) error {
+	err := p.run([]buildahCmd{
+		commandTag(p.Build, p.Build.StagingTag),
+		commandPush(p.Build, p.Build.StagingTag),
+	})
+	if err != nil {
+		return err
+	}
+	if len(p.Build.VerifyCommand) == 0 {
+		return nil
+	}
+
+	image := p.Build.tagRef(p.Build.StagingTag)
+	cmd := commandVerify(p.Build.VerifyCommand, image)
+	stderr := p.out.attach(cmd)
+	trace(cmd)
+	if err := p.runCmd(cmd); err != nil {
+		reportCaptured(cmd, stderr)
+		fmt.Printf("Verification of %s failed. Skipping push\n", image)
+		if p.Build.StagingCleanup {
+			if shared := p.sharedDigest(p.Build, p.Build.StagingTag, tags); shared != "" {
+				fmt.Printf("Could not delete staging tag %s, its digest is shared with %s. Ignoring...\n", image, shared)
+			} else {
+				p.run([]buildahCmd{deleteStep(p.Build, image)})
+			}
+		}
+		return fmt.Errorf("Error verifying %s: %s", image, err)
+	}
+	return nil
+}
+
+// helper function to create the verification command. The staging
+// image reference is exposed in the STAGING_IMAGE environment variable.
+func commandVerify(command []string, image string) *exec.Cmd {
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("STAGING_IMAGE=%s", image))
+	return cmd
+}
+
+// helper function to create the command deleting a tag from the
+// registry. buildah cannot delete remote tags, so skopeo is used. The
+// registry deletes the manifest by digest, so every tag pointing at the
+// same manifest is deleted with it.
+func commandDelete(build Build, image string) buildahCmd {
+	args := append([]string{"delete"}, tlsVerify(build.TLSVerify)...)
+	return buildahCmd{Cmd: exec.Command("skopeo", append(args, fmt.Sprintf("docker://%s", image))...)}
+}
+
+// helper function to create the batch step deleting a tag from the
+// registry, which is ignored when the tag does not exist.
+func deleteStep(build Build, image string) buildahCmd {
+	return ignored(commandDelete(build, image), "Could not delete tag %s. Ignoring...", image)
+}
+
+// helper function to create the command printing the raw manifest of
+// the tag in the registry.
+func commandManifestInspect(build Build, image string) buildahCmd {
+	args := append([]string{"inspect", "--raw"}, tlsVerify(build.TLSVerify)...)
+	return buildahCmd{Cmd: exec.Command("skopeo", append(args, fmt.Sprintf("docker://%s", image))...)}
+}
+
+// helper function to return the digest of the tag in the registry, or
+// an empty string when it does not exist there.
+func (p Plugin) remoteDigest(build Build, tag string) string {
+	out, err := p.output(commandManifestInspect(build, build.tagRef(tag)))
+	if err != nil || len(out) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(out))
+}
+
+// helper function to return the first of the other tags whose manifest
+// in the registry has the same digest as the tag, or an empty string
+// when none does. Deleting the tag would delete those tags too.
+func (p Plugin) sharedDigest(build Build, tag string, others []string) string {
+	digest := p.remoteDigest(build, tag)
+	if digest == "" {
+		return ""
+	}
+	for _, other := range others {
+		if other != tag && p.remoteDigest(build, other) == digest {
+			return other
+		}
+	}
+	return ""
+}
+
+// helper function to refuse the force push when a force pushed tag
+// shares its digest with another of the pushed tags, since deleting it
+// would delete the other tag as well.
+func (p Plugin) checkForcePush(build Build, tags []string) error {
+	for _, tag := range tags {
+		if !build.forcePush(tag) {
+			continue
+		}
+		if shared := p.sharedDigest(build, tag, tags); shared != "" {
+			return fmt.Errorf("Refusing to force push %s, deleting it would also delete %s which shares its digest", build.tagRef(tag), build.tagRef(shared))
+		}
+	}
+	return nil
+}
+
+// helper function to create the batch step for the push of the tag,
+// which fails the run unless push errors are ignored.
+func (b Build) pushStep(cmd buildahCmd, tag string) buildahCmd {
+	if b.IgnorePushErrors {
+		return ignored(cmd, "Could not push %s. Ignoring...", b.tagRef(tag))
+	}
+	return cmd
+}
+
+// helper function to report whether the tag is force pushed. Only
+// the tags confirmed in ForcePushTags are deleted before the push.
+func (b Build) forcePush(tag string) bool {
+	if !b.ForcePush {
+		return false
+	}
+	for _, t := range b.ForcePushTags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// default delay between push attempts.
+const pushRetryDelay = 10 * time.Second
+
+// helper function to run a push, retrying failed attempts up to the
+// configured number of retries and the run retry budget. The last error
+// is returned once the retries are exhausted.
+func (p Plugin) runPushRetried(cmd *exec.Cmd) error {
+	delay := p.Build.PushRetryDelay
+	if delay <= 0 {
+		delay = pushRetryDelay
+	}
+
+	stderr := cmd.Stderr
+	err := p.runCmd(cmd)
+	for attempt := 1; err != nil && attempt <= p.Build.PushRetries && !p.timedOut() && p.retries.take(); attempt++ {
+		fmt.Printf("Push failed: %s. Retrying in %s (attempt %d of %d)...\n", err, delay, attempt, p.Build.PushRetries)
+		time.Sleep(delay)
+		cmd = retryCommand(cmd)
+		cmd.Stderr = stderr
+		trace(cmd)
+		err = p.runCmd(cmd)
+	}
+	return err
+}
+
+// helper function to return the repositories the image is pushed to.
+func (b Build) repos() []string {
+	if len(b.Repos) != 0 {
+		return b.Repos
+	}
+	return []string{b.Repo}
+}
+
+// helper function to return the references the tags were tagged as in
+// the local storage: the tags of each repository, the staging tag and
+// the mirror tags. Full image references are only tagged once.
+func (p Plugin) taggedRefs(tags []string) []string {
+	var refs []string
+	for i, repo := range p.Build.repos() {
+		build := p.Build
+		build.Repo = repo
+		for _, tag := range tags {
+			if i == 0 || !isImageRef(tag) {
+				refs = append(refs, build.tagRef(tag))
+			}
+		}
+	}
+	if p.Dryrun {
+		return refs
+	}
+	if p.Build.StagingTag != "" {
+		refs = append(refs, p.Build.tagRef(p.Build.StagingTag))
+	}
+	if p.Mirror.Registry != "" {
+		mirror := p.Build
+		mirror.Repo = mirrorRepo(p.Build.Repo, p.Mirror.Registry)
+		for _, tag := range tags {
+			if isImageRef(tag) {
+				tag = mirrorRepo(tag, p.Mirror.Registry)
+			}
+			refs = append(refs, mirror.tagRef(tag))
+		}
+	}
+	return refs
+}
+
+// helper function to create the commands tagging and pushing the tags
+// to the repositories after the first. The image is built once and
+// pushed to the first repository, which the digests are recorded for.
+// Full image references are skipped, since they are pushed once.
+func (p Plugin) fanOut(tags []string) []buildahCmd {
+	var cmds []buildahCmd
+	for _, repo := range p.Build.repos()[1:] {
+		build := p.Build
+		build.Repo = repo
+		for _, tag := range tags {
+			if isImageRef(tag) {
+				continue
+			}
+			cmds = append(cmds, commandTag(build, tag)) // docker tag
+			if p.Dryrun == false {
+				if build.forcePush(tag) {
+					cmds = append(cmds, deleteStep(build, build.tagRef(tag)))
+				}
+				cmds = append(cmds, build.pushStep(commandPush(build, tag), tag)) // docker push
+			}
+		}
+	}
+	return cmds
+}
@@ -0,0 +1,141 @@
+package docker
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	// matches registry responses rejected by a rate limit.
+	rateLimited = regexp.MustCompile(`(?i)\b429\b|toomanyrequests|too many requests|rate limit`)
+
+	// matches the Retry-After header echoed in registry errors.
+	retryAfter = regexp.MustCompile(`(?i)retry-after:?\s*(\d+)`)
+)
+
+// default wait between rate limited attempts, and the default cap on
+// the total time spent waiting.
+const (
+	rateLimitWait    = 30 * time.Second
+	rateLimitMaxWait = 5 * time.Minute
+)
+
+// helper function to pull the cache images concurrently, bounded by
+// the plugin concurrency limit. The output of each pull is buffered and
+// written prefixed with the image name once the pull completes. Failed
+// pulls are ignored.
+func (p Plugin) pullParallel(images []string) {
+	limit := p.MaxConcurrency
+	if limit <= 0 || limit > len(images) {
+		limit = len(images)
+	}
+
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		sema = make(chan struct{}, limit)
+	)
+	for _, img := range images {
+		wg.Add(1)
+		go func(img string) {
+			defer wg.Done()
+			sema <- struct{}{}
+			defer func() { <-sema }()
+
+			var out bytes.Buffer
+			cmd := commandCachePull(p.Build, img)
+			p.prepare(cmd)
+			cmd.Stdout = &out
+			cmd.Stderr = &out
+			var err error
+			if p.HandleRateLimits {
+				err = p.runRateLimited(cmd.Cmd)
+			} else {
+				err = p.runCmd(cmd.Cmd)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			trace(cmd.Cmd)
+			scanner := bufio.NewScanner(&out)
+			for scanner.Scan() {
+				fmt.Fprintf(os.Stdout, "[%s] %s\n", img, scanner.Text())
+			}
+			if err != nil {
+				fmt.Printf("Could not pull cache-from image %s. Ignoring...\n", img)
+			}
+		}(img)
+	}
+	wg.Wait()
+}
+
+// helper function to run a command, waiting and retrying when the
+// registry rejects a request with a rate limit. The stderr of the
+// command is captured to detect the rate limit, and the wait honors
+// the Retry-After value when the registry provides one.
+func (p Plugin) runRateLimited(cmd *exec.Cmd) error {
+	maxWait := p.RateLimitMaxWait
+	if maxWait <= 0 {
+		maxWait = rateLimitMaxWait
+	}
+
+	var (
+		waited time.Duration
+		wait   = rateLimitWait
+		stderr = cmd.Stderr
+	)
+	for attempt := cmd; ; attempt = retryCommand(attempt) {
+		if attempt != cmd {
+			trace(attempt)
+		}
+		var buf bytes.Buffer
+		if stderr != nil {
+			attempt.Stderr = io.MultiWriter(stderr, &buf)
+		} else {
+			attempt.Stderr = &buf
+		}
+
+		err := p.runCmd(attempt)
+		if err == nil || !rateLimited.Match(buf.Bytes()) {
+			return err
+		}
+
+		next := wait
+		if match := retryAfter.FindSubmatch(buf.Bytes()); match != nil {
+			if seconds, perr := strconv.Atoi(string(match[1])); perr == nil {
+				next = time.Duration(seconds) * time.Second
+			}
+		}
+		if waited+next > maxWait {
+			fmt.Printf("Registry rate limit persisted after waiting %s. Giving up\n", waited)
+			return err
+		}
+		if !p.retries.take() {
+			return err
+		}
+		fmt.Printf("Registry rate limit reached. Retrying in %s...\n", next)
+		time.Sleep(next)
+		waited += next
+		wait *= 2
+	}
+}
+
+// helper function to copy a command for another attempt, since a
+// command cannot be run more than once.
+func retryCommand(cmd *exec.Cmd) *exec.Cmd {
+	retry := exec.Command(cmd.Path, cmd.Args[1:]...)
+	retry.Args = cmd.Args
+	retry.Env = cmd.Env
+	retry.Dir = cmd.Dir
+	retry.Stdin = cmd.Stdin
+	retry.Stdout = cmd.Stdout
+	return retry
+}
@@ -0,0 +1,78 @@
+package docker
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// build arg used to invalidate the layer cache of the rebuilt stages.
+const rebuildArg = "DRONE_REBUILD"
+
+// helper function to force a rebuild of the configured stages while
+// keeping the layer cache of the others. Buildah cannot invalidate the
+// cache of a single stage, so a copy of the Dockerfile is written that
+// declares a cache-busting build arg in each rebuilt stage. The arg is
+// set to the current time, so every RUN instruction in those stages
+// misses the cache; stages copying from them only rebuild when the
+// copied files change.
+func (p *Plugin) rebuildStages() error {
+	data, err := ioutil.ReadFile(p.Build.Dockerfile)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %s", p.Build.Dockerfile, err)
+	}
+	data, err = bustStages(data, p.Build.RebuildStages)
+	if err != nil {
+		return fmt.Errorf("Error rebuilding stages: %s", err)
+	}
+	path, err := p.work.writeFile("Dockerfile-*", data)
+	if err != nil {
+		return fmt.Errorf("Error writing Dockerfile: %s", err)
+	}
+
+	p.Build.Dockerfile = path
+	p.Build.Args = append(p.Build.Args, fmt.Sprintf("%s=%d", rebuildArg, time.Now().UnixNano()))
+	return nil
+}
+
+// helper function to declare the cache-busting build arg after the FROM
+// instruction of each named stage.
+func bustStages(dockerfile []byte, names []string) ([]byte, error) {
+	list, err := parseDockerfile(bytes.NewReader(dockerfile))
+	if err != nil {
+		return nil, err
+	}
+
+	stages := parseStages(list, nil)
+	lines := strings.Split(string(dockerfile), "\n")
+	after := map[int]bool{}
+	for _, name := range names {
+		found := false
+		for _, st := range stages {
+			if st.Name != name {
+				continue
+			}
+			// skip over continuation lines of the FROM instruction
+			end := st.Line - 1
+			for end < len(lines)-1 && strings.HasSuffix(strings.TrimSpace(lines[end]), "\\") {
+				end++
+			}
+			after[end] = true
+			found = true
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown stage %s", name)
+		}
+	}
+
+	var out []string
+	for i, line := range lines {
+		out = append(out, line)
+		if after[i] {
+			out = append(out, "ARG "+rebuildArg)
+		}
+	}
+	return []byte(strings.Join(out, "\n")), nil
+}
@@ -0,0 +1,51 @@
+package docker
+
+import "testing"
+
+func Test_bustStages(t *testing.T) {
+	dockerfile := `FROM golang:1.13 AS deps
+RUN go mod download
+FROM deps \
+    AS build
+RUN go build ./...
+FROM scratch
+COPY --from=build /go/bin/app /bin/app
+`
+	got, err := bustStages([]byte(dockerfile), []string{"deps"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `FROM golang:1.13 AS deps
+ARG DRONE_REBUILD
+RUN go mod download
+FROM deps \
+    AS build
+RUN go build ./...
+FROM scratch
+COPY --from=build /go/bin/app /bin/app
+`
+	if string(got) != want {
+		t.Errorf("Got Dockerfile\n%s\nwant\n%s", got, want)
+	}
+
+	got, err = bustStages([]byte(dockerfile), []string{"build"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = `FROM golang:1.13 AS deps
+RUN go mod download
+FROM deps \
+    AS build
+ARG DRONE_REBUILD
+RUN go build ./...
+FROM scratch
+COPY --from=build /go/bin/app /bin/app
+`
+	if string(got) != want {
+		t.Errorf("Got Dockerfile\n%s\nwant\n%s", got, want)
+	}
+
+	if _, err := bustStages([]byte(dockerfile), []string{"test"}); err == nil {
+		t.Errorf("Expect error for unknown stage")
+	}
+}
@@ -0,0 +1,56 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// artifact type of the build log attached to the pushed image.
+const buildLogArtifactType = "application/vnd.drone.build.log.v1+text"
+
+// helper function to create the file the build output is recorded in,
+// so it can be attached to the pushed image.
+func (p Plugin) openBuildLog() (*os.File, error) {
+	path, err := p.work.writeFile("build-*.log", nil)
+	if err != nil {
+		return nil, fmt.Errorf("Error creating build log: %s", err)
+	}
+	return os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+}
+
+// helper function to attach the build log to the pushed image as an OCI
+// referrer artifact whose subject is the image digest. The artifact is
+// pushed under the sha256-<digest>.log tag, which registries without the
+// referrers API can be queried with. Attaching artifacts requires
+// buildah 1.32 or later, and the registry must accept OCI 1.1 manifests
+// with a subject for the artifact to be listed as a referrer.
+func (p Plugin) attachLogs(digest string) error {
+	if digest == "" {
+		fmt.Println("Could not determine the image digest. Skipping build log...")
+		return nil
+	}
+	p.buildLog.Sync()
+
+	artifact := p.Build
+	artifact.Name = fmt.Sprintf("%s-logs", p.Build.Name)
+	subject := fmt.Sprintf("%s@%s", p.Build.Repo, digest)
+	target := fmt.Sprintf("%s:%s.log", p.Build.Repo, strings.Replace(digest, ":", "-", 1))
+	return p.run([]buildahCmd{
+		rmiStep(p.Build, artifact.Name),
+		commandManifestCreate(p.Build, artifact.Name),
+		commandArtifactAdd(p.Build, artifact.Name, subject, p.buildLog.Name()),
+		commandManifestPush(artifact, target),
+	})
+}
+
+// helper function to create the command adding a file to the list as
+// an artifact referring to the subject image.
+func commandArtifactAdd(build Build, list, subject, path string) buildahCmd {
+	return newCommand(
+		kindManifest, "manifest", "add", "--storage-driver", build.storageDriver(),
+		"--artifact", "--artifact-type", buildLogArtifactType,
+		"--artifact-subject", subject,
+		list, path,
+	)
+}
@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_commandArtifactAdd(t *testing.T) {
+	cmd := commandArtifactAdd(Build{}, "d8dbe4d9-logs", "octocat/hello-world@sha256:3b2a7c9e", "/tmp/build.log")
+	want := []string{
+		buildahExe, "manifest", "add", "--storage-driver", "vfs",
+		"--artifact", "--artifact-type", buildLogArtifactType,
+		"--artifact-subject", "octocat/hello-world@sha256:3b2a7c9e",
+		"d8dbe4d9-logs", "/tmp/build.log",
+	}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+}
+
+func Test_buildLog(t *testing.T) {
+	if _, err := exec.LookPath("echo"); err != nil {
+		t.Skip("echo not found")
+	}
+	home, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+
+	p := Plugin{work: &workdir{home: home}}
+	if p.buildLog, err = p.openBuildLog(); err != nil {
+		t.Fatal(err)
+	}
+	defer p.buildLog.Close()
+
+	// only the build commands are recorded, echo stands in for buildah
+	build := buildahCmd{Cmd: exec.Command("echo", "bud", "step 1/2"), kind: kindBuild}
+	push := buildahCmd{Cmd: exec.Command("echo", "push", "latest"), kind: kindPush}
+	if err := p.run([]buildahCmd{build, push}); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(p.buildLog.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(data); got != "bud step 1/2\n" || strings.Contains(got, "push") {
+		t.Errorf("Got build log %q, want the build output only", got)
+	}
+}
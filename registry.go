@@ -0,0 +1,143 @@
+package docker
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// harbor defines a Harbor registry API client. Harbor rejects pushes to
+// projects that do not exist, while other registries create the
+// repository on the first push.
+type harbor struct {
+	base   string // Base URL of the registry, e.g. https://harbor.example.com
+	login  Login
+	client *http.Client
+}
+
+// helper function to create the registry repository before the first
+// push. Only Harbor registries need the project created; for other
+// registries the repository is created by the push and nothing is done.
+// The registry is reached with the TLS verification of the push.
+func createRepo(login Login, repo string, verify *bool) error {
+	host, project := splitRepo(repo)
+	if host == "" {
+		host = login.Registry
+	}
+	if host == "" || project == "" {
+		fmt.Printf("Could not determine the registry for %s. Skipping repository creation...\n", repo)
+		return nil
+	}
+
+	h := newHarbor(host, login, verify)
+	if !h.detect() && verify != nil && !*verify {
+		// like buildah, fall back to plain http without TLS verification
+		h.base = "http://" + strings.TrimPrefix(h.base, "https://")
+	}
+	if !h.detect() {
+		fmt.Printf("Registry %s creates repositories on push. Skipping repository creation...\n", host)
+		return nil
+	}
+	if err := h.createProject(project); err != nil {
+		return fmt.Errorf("Error creating repository %s: %s", repo, err)
+	}
+	return nil
+}
+
+// helper function to create the Harbor client for the registry host.
+// With TLS verification disabled the registry certificate is not
+// verified, so self-signed registries the plugin pushes to are reached.
+func newHarbor(host string, login Login, verify *bool) harbor {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if verify != nil && !*verify {
+		transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+	}
+	return harbor{
+		base:   "https://" + strings.TrimPrefix(strings.TrimPrefix(host, "https://"), "http://"),
+		login:  login,
+		client: &http.Client{Timeout: 10 * time.Second, Transport: transport},
+	}
+}
+
+// helper function to split the repository into the registry host and
+// the first path component, which is the Harbor project. The host is
+// empty for Docker Hub repositories.
+func splitRepo(repo string) (host, project string) {
+	parts := strings.Split(repo, "/")
+	if len(parts) > 1 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		host, parts = parts[0], parts[1:]
+	}
+	if len(parts) > 1 {
+		project = parts[0]
+	}
+	return host, project
+}
+
+// helper function to report whether the registry is a Harbor registry.
+func (h harbor) detect() bool {
+	res, err := h.client.Get(h.base + "/api/v2.0/systeminfo")
+	if err != nil {
+		return false
+	}
+	defer res.Body.Close()
+
+	var info struct {
+		Version string `json:"harbor_version"`
+	}
+	if res.StatusCode != http.StatusOK || json.NewDecoder(res.Body).Decode(&info) != nil {
+		return false
+	}
+	return info.Version != ""
+}
+
+// helper function to create the Harbor project unless it exists.
+func (h harbor) createProject(project string) error {
+	req, err := http.NewRequest(http.MethodHead, h.base+"/api/v2.0/projects?project_name="+url.QueryEscape(project), nil)
+	if err != nil {
+		return err
+	}
+	res, err := h.do(req)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+	default:
+		return fmt.Errorf("unexpected status %s checking project %s", res.Status, project)
+	}
+
+	body, err := json.Marshal(map[string]interface{}{"project_name": project})
+	if err != nil {
+		return err
+	}
+	req, err = http.NewRequest(http.MethodPost, h.base+"/api/v2.0/projects", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if res, err = h.do(req); err != nil {
+		return err
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		return fmt.Errorf("unexpected status %s creating project %s", res.Status, project)
+	}
+	fmt.Printf("Created Harbor project %s\n", project)
+	return nil
+}
+
+// helper function to send an authenticated request to the registry.
+func (h harbor) do(req *http.Request) (*http.Response, error) {
+	if h.login.Username != "" {
+		req.SetBasicAuth(h.login.Username, h.login.Password)
+	}
+	return h.client.Do(req)
+}
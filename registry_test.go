@@ -0,0 +1,107 @@
+package docker
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_splitRepo(t *testing.T) {
+	tests := []struct {
+		Repo    string
+		Host    string
+		Project string
+	}{
+		{Repo: "harbor.example.com/library/app", Host: "harbor.example.com", Project: "library"},
+		{Repo: "localhost:5000/team/app", Host: "localhost:5000", Project: "team"},
+		{Repo: "octocat/hello-world", Project: "octocat"},
+		{Repo: "harbor.example.com/app", Host: "harbor.example.com"},
+		{Repo: "alpine"},
+	}
+	for _, test := range tests {
+		host, project := splitRepo(test.Repo)
+		if host != test.Host || project != test.Project {
+			t.Errorf("Got %s, %s for %s, want %s, %s", host, project, test.Repo, test.Host, test.Project)
+		}
+	}
+}
+
+func Test_harborCreateProject(t *testing.T) {
+	projects := map[string]bool{"library": true}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2.0/systeminfo" {
+			w.Write([]byte(`{"harbor_version":"v2.1.0"}`))
+			return
+		}
+		if user, pass, _ := r.BasicAuth(); user != "octocat" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodHead && r.URL.Path == "/api/v2.0/projects":
+			if !projects[r.URL.Query().Get("project_name")] {
+				w.WriteHeader(http.StatusNotFound)
+			}
+		case r.Method == http.MethodPost && r.URL.Path == "/api/v2.0/projects":
+			projects["team"] = true
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	h := harbor{base: server.URL, login: Login{Username: "octocat", Password: "secret"}, client: server.Client()}
+	if !h.detect() {
+		t.Errorf("Expect Harbor registry detected")
+	}
+	if err := h.createProject("library"); err != nil {
+		t.Errorf("Unexpected error for existing project: %s", err)
+	}
+	if err := h.createProject("team"); err != nil || !projects["team"] {
+		t.Errorf("Expect project created, got error %v", err)
+	}
+
+	h.login.Password = "wrong"
+	if err := h.createProject("other"); err == nil {
+		t.Errorf("Expect error for rejected credentials")
+	}
+	if (harbor{base: server.URL + "/registry", client: server.Client()}).detect() {
+		t.Errorf("Unexpected Harbor registry detected")
+	}
+}
+
+func Test_createRepoTLSVerify(t *testing.T) {
+	var created []string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/api/v2.0/systeminfo":
+			w.Write([]byte(`{"harbor_version":"v2.1.0"}`))
+		case r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodPost:
+			created = append(created, r.Host)
+			w.WriteHeader(http.StatusCreated)
+		}
+	})
+	secure := httptest.NewTLSServer(handler)
+	defer secure.Close()
+	plain := httptest.NewServer(handler)
+	defer plain.Close()
+
+	verify, skip := true, false
+	for _, server := range []*httptest.Server{secure, plain} {
+		created = nil
+		host := strings.TrimPrefix(strings.TrimPrefix(server.URL, "https://"), "http://")
+
+		// the self-signed or plain http registry is not detected as
+		// Harbor with TLS verification
+		if err := createRepo(Login{}, host+"/team/app", &verify); err != nil || len(created) != 0 {
+			t.Errorf("Expect %s skipped with TLS verification, got %v, %v", server.URL, created, err)
+		}
+		if err := createRepo(Login{}, host+"/team/app", &skip); err != nil || len(created) != 1 {
+			t.Errorf("Expect project created on %s without TLS verification, got %v, %v", server.URL, created, err)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package docker
+
+import (
+	"fmt"
+	"sync"
+)
+
+// retryBudget defines the number of retries left for the whole run,
+// shared by every retried operation.
+type retryBudget struct {
+	mu   sync.Mutex
+	left int
+}
+
+// helper function to take a retry from the budget, reporting whether
+// the retry may run. A nil budget is unlimited, leaving the retries to
+// the per-operation settings.
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.left <= 0 {
+		fmt.Println("Retry budget exhausted. Giving up")
+		return false
+	}
+	b.left--
+	fmt.Printf("Retry budget: %d retries left\n", b.left)
+	return true
+}
@@ -0,0 +1,39 @@
+package docker
+
+import (
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func Test_retryBudget(t *testing.T) {
+	var unlimited *retryBudget
+	if !unlimited.take() {
+		t.Errorf("Expect retries without a budget")
+	}
+
+	budget := &retryBudget{left: 2}
+	for i := 0; i < 2; i++ {
+		if !budget.take() {
+			t.Errorf("Expect retry %d within the budget", i+1)
+		}
+	}
+	if budget.take() {
+		t.Errorf("Unexpected retry once the budget is exhausted")
+	}
+}
+
+func Test_retryBudgetShared(t *testing.T) {
+	if _, err := exec.LookPath("false"); err != nil {
+		t.Skip("false not found")
+	}
+
+	p := Plugin{Build: Build{PushRetries: 5, PushRetryDelay: time.Millisecond}, retries: &retryBudget{left: 3}}
+	p.runPushRetried(exec.Command("false"))
+	if p.retries.left != 0 {
+		t.Errorf("Got %d retries left, want the budget used by the push", p.retries.left)
+	}
+	if err := p.runPushRetried(exec.Command("false")); err == nil {
+		t.Errorf("Expect error without retries left")
+	}
+}
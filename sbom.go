@@ -0,0 +1,54 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// buildah release that added the --sbom build flags.
+const sbomMinVersion = "1.31.0"
+
+// default scan preset, generating an SPDX document with syft.
+const sbomDefaultScanner = "syft-spdx"
+
+// scan presets buildah ships for the --sbom flag.
+var sbomScanners = map[string]bool{
+	"syft":            true,
+	"syft-cyclonedx":  true,
+	"syft-spdx":       true,
+	"trivy":           true,
+	"trivy-cyclonedx": true,
+	"trivy-spdx":      true,
+}
+
+// helper function to return the scan preset the SBOM is generated with.
+func (b Build) sbomScanner() string {
+	if b.SBOMScanner != "" {
+		return b.SBOMScanner
+	}
+	return sbomDefaultScanner
+}
+
+// helper function to fail with a clear error when the installed
+// buildah does not support SBOM generation, instead of buildah failing
+// on an unknown flag.
+func checkSBOMSupport(version string) error {
+	older, err := olderVersion(version, sbomMinVersion)
+	if err != nil {
+		return fmt.Errorf("Error comparing buildah version: %s", err)
+	}
+	if older {
+		return fmt.Errorf("SBOM generation requires buildah %s or later, found %s", sbomMinVersion, version)
+	}
+	return nil
+}
+
+// helper function to create the parent directory of the SBOM output
+// file, which buildah does not create.
+func prepareSBOMOutput(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Error creating SBOM output directory: %s", err)
+	}
+	return nil
+}
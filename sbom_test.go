@@ -0,0 +1,57 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCommandBuildSBOM(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Dockerfile: "Dockerfile", Context: ".", SBOM: true, SBOMOutput: "sbom/image.spdx.json"}
+	args := commandBuild(build).Args
+	if !hasArgs(args, "--sbom", "syft-spdx") || !hasArgs(args, "--sbom-output", "sbom/image.spdx.json") {
+		t.Errorf("Expect the default sbom preset and the output in %v", args)
+	}
+	if err := build.validate(); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	build.SBOMScanner = "trivy-cyclonedx"
+	if args := commandBuild(build).Args; !hasArgs(args, "--sbom", "trivy-cyclonedx") {
+		t.Errorf("Expect the trivy-cyclonedx preset in %v", args)
+	}
+	build.SBOMScanner = "spdx"
+	if err := build.validate(); err == nil {
+		t.Errorf("Expect error for an unknown sbom preset")
+	}
+	if args := commandBuild(Build{Name: "d8dbe4d9"}).Args; hasArg(args, "--sbom") {
+		t.Errorf("Unexpected --sbom in %v", args)
+	}
+}
+
+func Test_checkSBOMSupport(t *testing.T) {
+	if err := checkSBOMSupport("1.33.2"); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+	want := "SBOM generation requires buildah 1.31.0 or later, found 1.23.1"
+	if err := checkSBOMSupport("1.23.1"); err == nil || err.Error() != want {
+		t.Errorf("Got error %v, want %s", err, want)
+	}
+}
+
+func Test_prepareSBOMOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "reports", "sbom", "image.spdx.json")
+	if err := prepareSBOMOutput(path); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Dir(path)); err != nil || !info.IsDir() {
+		t.Errorf("Expect the sbom output directory created")
+	}
+}
@@ -0,0 +1,60 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+const cosignExe = "cosign"
+
+// helper function to sign the pushed image references with cosign.
+// Signing failures fail the step, so unsigned images are never reported
+// as published.
+func (p Plugin) sign(refs []string) error {
+	key := p.Build.CosignKey
+	if strings.HasPrefix(strings.TrimSpace(key), "-----BEGIN") {
+		path, err := p.work.writeFile("cosign-*.key", []byte(key))
+		if err != nil {
+			return fmt.Errorf("Error writing cosign key: %s", err)
+		}
+		key = path
+	}
+
+	for _, image := range refs {
+		cmd := commandSign(key, p.Build.CosignPassword, image)
+		stderr := p.out.attach(cmd)
+		trace(cmd)
+		if err := p.runCmd(cmd); err != nil {
+			reportCaptured(cmd, stderr)
+			return fmt.Errorf("Error signing %s: %s", image, err)
+		}
+	}
+	return nil
+}
+
+// helper function to return the references of the pushed tags in every
+// repository, matching the pushes of the fan-out.
+func (b Build) signRefs(tags []string) []string {
+	var refs []string
+	for i, repo := range b.repos() {
+		build := b
+		build.Repo = repo
+		for _, tag := range tags {
+			if i == 0 || !isImageRef(tag) {
+				refs = append(refs, build.tagRef(tag))
+			}
+		}
+	}
+	return refs
+}
+
+// helper function to create the cosign sign command. The key password
+// is passed in the COSIGN_PASSWORD environment variable, so it is not
+// traced.
+func commandSign(key, password, image string) *exec.Cmd {
+	cmd := exec.Command(cosignExe, "sign", "--yes", "--key", key, image)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("COSIGN_PASSWORD=%s", password))
+	return cmd
+}
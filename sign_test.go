@@ -0,0 +1,94 @@
+package docker
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCommandSign(t *testing.T) {
+	cmd := commandSign("cosign.key", "secret", "octocat/hello-world:latest")
+	if want := []string{"cosign", "sign", "--yes", "--key", "cosign.key", "octocat/hello-world:latest"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got sign command %v, want %v", cmd.Args, want)
+	}
+	if !hasArg(cmd.Env, "COSIGN_PASSWORD=secret") {
+		t.Errorf("Expect the key password in the command env")
+	}
+
+	if err := (Build{Sign: true}).validate(); err == nil {
+		t.Errorf("Expect error for signing without a key")
+	}
+}
+
+func Test_signRefs(t *testing.T) {
+	build := Build{Repos: []string{"octocat/hello-world", "harbor.example.com/octocat/hello-world"}, Repo: "octocat/hello-world"}
+	got := build.signRefs([]string{"latest", "ghcr.io/octocat/hello-world:1.0"})
+	want := []string{
+		"octocat/hello-world:latest",
+		"ghcr.io/octocat/hello-world:1.0",
+		"harbor.example.com/octocat/hello-world:latest",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got signed refs %v, want %v", got, want)
+	}
+}
+
+func TestSignVariantAndTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// buildah stand-in accepting every command and a cosign stand-in
+	// logging the signed references
+	calls := filepath.Join(dir, "calls")
+	scripts := map[string]string{
+		buildahExe: "#!/bin/sh\n",
+		cosignExe:  "#!/bin/sh\necho \"$5\" >> " + calls + "\n",
+	}
+	for name, script := range scripts {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(script), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	p := Plugin{
+		Build: Build{
+			Name:      "d8dbe4d9",
+			Repo:      "octocat/hello-world",
+			Sign:      true,
+			CosignKey: "cosign.key",
+		},
+		out: &outputs{},
+	}
+	if err := p.buildVariant(Variant{Tag: "debug"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.buildTarget("tools", "octocat/hello-tools", []string{"latest", "ghcr.io/octocat/hello-world:1.0"}); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := strings.Fields(string(data))
+	want := []string{"octocat/hello-world:debug", "octocat/hello-tools:latest"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got signed refs %v, want %v", got, want)
+	}
+
+	// a signing failure fails the variant
+	if err := ioutil.WriteFile(filepath.Join(dir, cosignExe), []byte("#!/bin/sh\nexit 1\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.buildVariant(Variant{Tag: "debug"}); err == nil {
+		t.Errorf("Expect error when signing the variant fails")
+	}
+}
@@ -0,0 +1,33 @@
+package docker
+
+import "testing"
+
+func Test_parseSize(t *testing.T) {
+	tests := []struct {
+		Size string
+		Want int64
+	}{
+		{"512", 512},
+		{"500m", 500 << 20},
+		{"500MB", 500 << 20},
+		{"1.5g", 3 << 29},
+		{"2GiB", 2 << 30},
+		{"10k", 10 << 10},
+	}
+	for _, test := range tests {
+		got, err := parseSize(test.Size)
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got != test.Want {
+			t.Errorf("Got size %d for %s, want %d", got, test.Size, test.Want)
+		}
+	}
+
+	for _, size := range []string{"", "m", "10x", "-5m"} {
+		if _, err := parseSize(size); err == nil {
+			t.Errorf("Expect error for size %q", size)
+		}
+	}
+}
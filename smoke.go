@@ -0,0 +1,29 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// helper function to run the smoke test command inside a working
+// container created from the built image.
+func (p Plugin) smokeTest() error {
+	out, err := p.output(commandFrom(p.Build, p.Build.Name))
+	if err != nil {
+		return fmt.Errorf("Error creating working container: %s", err)
+	}
+	container := strings.TrimSpace(string(out))
+	defer p.run([]buildahCmd{commandRm(p.Build, container)})
+
+	if err := p.run([]buildahCmd{commandRun(p.Build, container, p.Build.SmokeTest)}); err != nil {
+		return fmt.Errorf("Error running smoke test: %s", err)
+	}
+	return nil
+}
+
+// helper function to create the buildah run command.
+func commandRun(build Build, container string, command []string) buildahCmd {
+	args := []string{"run", "--storage-driver", build.storageDriver(), container, "--"}
+	args = append(args, command...)
+	return newCommand(kindOther, args...)
+}
@@ -0,0 +1,14 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_commandRun(t *testing.T) {
+	cmd := commandRun(Build{}, "alpine-working-container", []string{"/bin/app", "--version"})
+	want := []string{buildahExe, "run", "--storage-driver", "vfs", "alpine-working-container", "--", "/bin/app", "--version"}
+	if !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("Got arguments %v, want %v", cmd.Args, want)
+	}
+}
@@ -0,0 +1,156 @@
+package docker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// summary defines the results of a plugin run.
+type summary struct {
+	Image          string        // Image built
+	Repo           string        // Repository pushed to
+	Tags           []string      // Tags pushed
+	Digest         string        // Digest of the pushed image
+	Commit         string        // Git commit sha
+	Branch         string        // Git commit branch
+	BuildahVersion string        // Version of buildah used
+	Stdout         string        // Command output captured for the summary
+	Stderr         string        // Command errors captured for the summary
+	Duration       time.Duration // Duration of the run
+	Err            error         // Error the run failed with
+}
+
+type (
+	slackMessage struct {
+		Text        string            `json:"text"`
+		Attachments []slackAttachment `json:"attachments"`
+	}
+
+	slackAttachment struct {
+		Color  string       `json:"color"`
+		Fields []slackField `json:"fields"`
+	}
+
+	slackField struct {
+		Title string `json:"title"`
+		Value string `json:"value"`
+		Short bool   `json:"short"`
+	}
+)
+
+// helper function to create the Slack message for a run.
+func slackPayload(sum *summary) slackMessage {
+	var (
+		text  = fmt.Sprintf("Built and published %s", sum.Repo)
+		color = "good"
+	)
+	if sum.Err != nil {
+		text = fmt.Sprintf("Failed to build %s: %s", sum.Repo, sum.Err)
+		color = "danger"
+	}
+
+	var fields []slackField
+	add := func(title, value string, short bool) {
+		if value != "" {
+			fields = append(fields, slackField{Title: title, Value: value, Short: short})
+		}
+	}
+	add("Image", sum.Image, true)
+	add("Tags", strings.Join(sum.Tags, ", "), true)
+	add("Digest", sum.Digest, false)
+	add("Commit", sum.Commit, true)
+	add("Branch", sum.Branch, true)
+	add("Buildah", sum.BuildahVersion, true)
+	add("Duration", sum.Duration.Round(time.Second).String(), true)
+
+	return slackMessage{
+		Text:        text,
+		Attachments: []slackAttachment{{Color: color, Fields: fields}},
+	}
+}
+
+// version of the build metadata schema, bumped on incompatible changes.
+const metadataSchemaVersion = 1
+
+// metadata defines the build metadata written for other tools.
+type metadata struct {
+	SchemaVersion int      `json:"schemaVersion"`
+	Image         string   `json:"image"`
+	Repo          string   `json:"repo"`
+	Tags          []string `json:"tags"`
+	Digest        string   `json:"digest"`
+	Platforms     []string `json:"platforms"`
+	Duration      float64  `json:"durationSeconds"`
+}
+
+// helper function to write the build metadata of a successful run as
+// JSON. Lists are always present, so consumers need not handle nulls.
+func writeMetadata(path string, sum *summary, platforms []string) error {
+	meta := metadata{
+		SchemaVersion: metadataSchemaVersion,
+		Image:         sum.Image,
+		Repo:          sum.Repo,
+		Tags:          append([]string{}, sum.Tags...),
+		Digest:        sum.Digest,
+		Platforms:     append([]string{}, platforms...),
+		Duration:      sum.Duration.Seconds(),
+	}
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(path, append(data, '\n')); err != nil {
+		return fmt.Errorf("Error writing output file: %s", err)
+	}
+	fmt.Printf("Build metadata written to %s\n", path)
+	return nil
+}
+
+// helper function to append the image, digest and tags of the run as
+// name=value lines to the GitHub Actions output file. Nothing is written
+// when the file is not set.
+func writeGithubOutput(path string, sum *summary) error {
+	if path == "" {
+		return nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	outputs := []string{
+		fmt.Sprintf("image=%s", sum.Repo),
+		fmt.Sprintf("digest=%s", sum.Digest),
+		fmt.Sprintf("tags=%s", strings.Join(sum.Tags, ",")),
+	}
+	if _, err := fmt.Fprintln(f, strings.Join(outputs, "\n")); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// helper function to post the run summary to a Slack webhook.
+func notifySlack(webhook string, sum *summary) error {
+	body, err := json.Marshal(slackPayload(sum))
+	if err != nil {
+		return err
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	res, err := client.Post(webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %s", res.Status)
+	}
+	return nil
+}
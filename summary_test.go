@@ -0,0 +1,120 @@
+package docker
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotifySlack(t *testing.T) {
+	var got slackMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		json.Unmarshal(body, &got)
+	}))
+	defer server.Close()
+
+	sum := &summary{
+		Image:          "d8dbe4d9",
+		Repo:           "octocat/hello-world",
+		Tags:           []string{"latest", "1.0"},
+		Commit:         "d8dbe4d9",
+		Branch:         "master",
+		Duration:       90 * time.Second,
+		BuildahVersion: "1.23.1",
+	}
+	if err := notifySlack(server.URL, sum); err != nil {
+		t.Fatal(err)
+	}
+	if got.Text != "Built and published octocat/hello-world" {
+		t.Errorf("Got text %q", got.Text)
+	}
+	if len(got.Attachments) != 1 || got.Attachments[0].Color != "good" {
+		t.Fatalf("Got attachments %v", got.Attachments)
+	}
+	fields := map[string]string{}
+	for _, field := range got.Attachments[0].Fields {
+		fields[field.Title] = field.Value
+	}
+	if fields["Tags"] != "latest, 1.0" || fields["Branch"] != "master" || fields["Duration"] != "1m30s" || fields["Buildah"] != "1.23.1" {
+		t.Errorf("Got fields %v", fields)
+	}
+	if _, ok := fields["Digest"]; ok {
+		t.Errorf("Expect empty digest to be omitted")
+	}
+
+	sum.Err = errors.New("exit status 1")
+	if msg := slackPayload(sum); msg.Attachments[0].Color != "danger" {
+		t.Errorf("Expect failed run to be reported as danger")
+	}
+}
+
+func TestWriteGithubOutput(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "output")
+	if err := ioutil.WriteFile(path, []byte("previous=step\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := &summary{Repo: "octocat/hello-world", Digest: "sha256:3b2a7c9e", Tags: []string{"latest", "1.0"}}
+	if err := writeGithubOutput(path, sum); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "previous=step\nimage=octocat/hello-world\ndigest=sha256:3b2a7c9e\ntags=latest,1.0\n"
+	if got := string(data); got != want {
+		t.Errorf("Got outputs %q, want %q", got, want)
+	}
+
+	if err := writeGithubOutput("", sum); err != nil {
+		t.Errorf("Unexpected error without an output file: %s", err)
+	}
+}
+
+func TestWriteMetadata(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "build.json")
+	sum := &summary{Image: "d8dbe4d9", Repo: "octocat/hello-world", Tags: []string{"latest"}, Duration: 90 * time.Second}
+	if err := writeMetadata(path, sum, nil); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"schemaVersion":   float64(1),
+		"image":           "d8dbe4d9",
+		"repo":            "octocat/hello-world",
+		"tags":            []interface{}{"latest"},
+		"digest":          "",
+		"platforms":       []interface{}{},
+		"durationSeconds": float64(90),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got metadata %v, want %v", got, want)
+	}
+}
@@ -1,8 +1,14 @@
 package docker
 
 import (
+	"bufio"
 	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
 	"strings"
+	"text/template"
+	"time"
 
 	"github.com/coreos/go-semver/semver"
 )
@@ -14,8 +20,14 @@ func DefaultTagSuffix(ref, suffix string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
+	return suffixTags(tags, suffix), nil
+}
+
+// helper function to attach the suffix to the tags, replacing the
+// latest tag with the suffix.
+func suffixTags(tags []string, suffix string) []string {
 	if len(suffix) == 0 {
-		return tags, nil
+		return tags
 	}
 	for i, tag := range tags {
 		if tag == "latest" {
@@ -24,7 +36,25 @@ func DefaultTagSuffix(ref, suffix string) ([]string, error) {
 			tags[i] = fmt.Sprintf("%s-%s", tag, suffix)
 		}
 	}
-	return tags, nil
+	return tags
+}
+
+// helper function to expand the semantic version into the cascade of
+// major, minor and full version tags followed by latest, with the suffix
+// attached. Pre-release versions only produce the full version tag, with
+// the build metadata separator replaced as it is not valid in a tag.
+func versionTags(version, suffix string) ([]string, error) {
+	tags, err := DefaultTags("refs/tags/" + version)
+	if err != nil {
+		return nil, err
+	}
+	for i, tag := range tags {
+		tags[i] = strings.Replace(tag, "+", "-", -1)
+	}
+	if v, err := semver.NewVersion(stripTagPrefix(version)); err == nil && v.PreRelease == "" && v.Metadata == "" {
+		tags = append(tags, "latest")
+	}
+	return suffixTags(tags, suffix), nil
 }
 
 func splitOff(input string, delim string) string {
@@ -91,3 +121,196 @@ func stripTagPrefix(ref string) string {
 	ref = strings.TrimPrefix(ref, "v")
 	return ref
 }
+
+// helper function to report whether the tag is a full image reference,
+// such as registry.example.com/app:1.0, rather than a bare tag. A full
+// reference ends with a tag after its last path component.
+func isImageRef(tag string) bool {
+	name := tag[strings.LastIndex(tag, "/")+1:]
+	return !strings.Contains(tag, "@") && strings.Contains(name, ":") && !strings.HasSuffix(name, ":")
+}
+
+// helper function to check the tag is either a bare tag or a full image
+// reference, so a reference is never appended to the repository.
+func validateTag(tag string) error {
+	if !isImageRef(tag) && strings.ContainsAny(tag, "/:@") {
+		return fmt.Errorf("Invalid tag %s: use a bare tag or a full image reference ending with a tag", tag)
+	}
+	return nil
+}
+
+// helper function to return the image reference the tag is pushed as.
+// Full image references are pushed as-is, bare tags to the repository.
+func (b Build) tagRef(tag string) string {
+	if isImageRef(tag) {
+		return tag
+	}
+	return fmt.Sprintf("%s:%s", b.Repo, tag)
+}
+
+// helper function to return the repository the tag is pushed to.
+func (b Build) tagRepo(tag string) string {
+	if !isImageRef(tag) {
+		return b.Repo
+	}
+	return tag[:strings.LastIndex(tag, ":")]
+}
+
+// matches the characters not allowed in a docker tag.
+var invalidTagChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+// SanitizeTags returns the tags with invalid characters replaced, so
+// each value is a valid docker tag. Tags left empty are dropped, and
+// full image references are kept as-is.
+func SanitizeTags(tags []string) []string {
+	var sanitized []string
+	for _, tag := range tags {
+		if isImageRef(tag) {
+			sanitized = append(sanitized, tag)
+			continue
+		}
+		tag = invalidTagChars.ReplaceAllString(tag, "-")
+		tag = strings.TrimLeft(tag, ".-")
+		if len(tag) > 128 {
+			tag = tag[:128]
+		}
+		if tag != "" {
+			sanitized = append(sanitized, tag)
+		}
+	}
+	return sanitized
+}
+
+// helper function to read newline separated tags from a file,
+// ignoring blank lines and comments.
+func readTagsFile(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tags []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		tags = append(tags, line)
+	}
+	return tags, scanner.Err()
+}
+
+// helper function to remove duplicate tags, preserving order.
+func uniqueTags(tags []string) []string {
+	var (
+		unique []string
+		seen   = map[string]bool{}
+	)
+	for _, tag := range tags {
+		if !seen[tag] {
+			seen[tag] = true
+			unique = append(unique, tag)
+		}
+	}
+	return unique
+}
+
+// matches a full or abbreviated git commit sha.
+var commitSHA = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// helper function to return the commit sha truncated to the configured
+// length. The sha is read from the build name, which defaults to the
+// commit sha, falling back to git when it is unset or a placeholder.
+func shortSHA(build Build) string {
+	sha := build.Name
+	if !commitSHA.MatchString(sha) || strings.Trim(sha, "0") == "" {
+		out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+		if err != nil {
+			return ""
+		}
+		sha = strings.TrimSpace(string(out))
+	}
+
+	length := build.SHALength
+	if length <= 0 {
+		length = 7
+	}
+	if length < len(sha) {
+		sha = sha[:length]
+	}
+	return sha
+}
+
+var (
+	// matches a registry host with an optional port.
+	registryHost = regexp.MustCompile(`^[A-Za-z0-9.-]+(:[0-9]+)?$`)
+
+	// matches a single repository path component.
+	repoComponent = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+)
+
+// helper function to check the reference is a repository, without a tag
+// or digest.
+func validateRepo(repo string) error {
+	parts := strings.Split(repo, "/")
+	if len(parts) > 1 && (strings.ContainsAny(parts[0], ".:") || parts[0] == "localhost") {
+		if !registryHost.MatchString(parts[0]) {
+			return fmt.Errorf("invalid registry %s", parts[0])
+		}
+		parts = parts[1:]
+	}
+	for _, part := range parts {
+		if !repoComponent.MatchString(part) {
+			return fmt.Errorf("invalid repository component %q", part)
+		}
+	}
+	return nil
+}
+
+// tagContext defines the variables available to tag templates.
+type tagContext struct {
+	Branch      string // Git commit branch
+	SHA         string // Git commit sha
+	ShortSHA    string // Git commit sha truncated to the sha length
+	Tag         string // Git tag, for tag events
+	BuildNumber int    // Drone build number
+	Date        string // Build date (YYYYMMDD, UTC)
+}
+
+// helper function to create the tag template context for the build.
+func newTagContext(build Build, now time.Time) tagContext {
+	ctx := tagContext{
+		Branch:      build.Branch,
+		SHA:         build.Name,
+		ShortSHA:    shortSHA(build),
+		BuildNumber: build.BuildNumber,
+		Date:        now.UTC().Format("20060102"),
+	}
+	if strings.HasPrefix(build.Ref, "refs/tags/") {
+		ctx.Tag = strings.TrimPrefix(build.Ref, "refs/tags/")
+	}
+	return ctx
+}
+
+// helper function to render the tag templates, e.g.
+// {{.Branch}}-{{.ShortSHA}} or {{.Date}}.{{.BuildNumber}}. Templates
+// that render empty, such as {{.Tag}} outside tag events, are skipped.
+func renderTagTemplates(templates []string, ctx tagContext) ([]string, error) {
+	var tags []string
+	for _, text := range templates {
+		tmpl, err := template.New("tag").Option("missingkey=error").Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		var sb strings.Builder
+		if err := tmpl.Execute(&sb, ctx); err != nil {
+			return nil, err
+		}
+		if tag := strings.TrimSpace(sb.String()); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags, nil
+}
@@ -1,8 +1,11 @@
 package docker
 
 import (
+	"io/ioutil"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func Test_stripTagPrefix(t *testing.T) {
@@ -195,3 +198,192 @@ func TestUseDefaultTag(t *testing.T) {
 		}
 	}
 }
+
+func TestSanitizeTags(t *testing.T) {
+	got := SanitizeTags([]string{
+		"latest",
+		"feature/login",
+		"-rc.1",
+		"v1+build.5",
+		"///",
+	})
+	want := []string{
+		"latest",
+		"feature-login",
+		"rc.1",
+		"v1-build.5",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got tags %v, want %v", got, want)
+	}
+}
+
+func Test_readTagsFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "tags")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString("# generated tags\n1.0.0\n\n  1.0  \nlatest\n")
+	f.Close()
+
+	got, err := readTagsFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"1.0.0", "1.0", "latest"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got tags %v, want %v", got, want)
+	}
+
+	if _, err := readTagsFile(f.Name() + ".missing"); err == nil {
+		t.Errorf("Expect error for missing tags file")
+	}
+}
+
+func Test_shortSHA(t *testing.T) {
+	tests := []struct {
+		Build Build
+		Want  string
+	}{
+		{Build{Name: "d8dbe4d94f15fe89232e0402c6e8a0ddf21af3ab"}, "d8dbe4d"},
+		{Build{Name: "d8dbe4d94f15fe89232e0402c6e8a0ddf21af3ab", SHALength: 12}, "d8dbe4d94f15"},
+		{Build{Name: "d8dbe4d", SHALength: 12}, "d8dbe4d"},
+	}
+	for _, test := range tests {
+		if got := shortSHA(test.Build); got != test.Want {
+			t.Errorf("Got sha %s, want %s", got, test.Want)
+		}
+	}
+}
+
+func Test_renderTagTemplates(t *testing.T) {
+	build := Build{
+		Name:        "8f51ad7884c5eb69c11d260a31da7a745e6b78e2",
+		Branch:      "master",
+		Ref:         "refs/tags/v1.0.0",
+		BuildNumber: 42,
+	}
+	ctx := newTagContext(build, time.Date(2019, 10, 2, 23, 0, 0, 0, time.UTC))
+	templates := []string{"{{.Branch}}-{{.ShortSHA}}", "{{.Date}}.{{.BuildNumber}}", "{{.Tag}}", "{{.SHA}}"}
+	got, err := renderTagTemplates(templates, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"master-8f51ad7", "20191002.42", "v1.0.0", "8f51ad7884c5eb69c11d260a31da7a745e6b78e2"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got tags %v, want %v", got, want)
+	}
+
+	build.Ref = "refs/heads/master"
+	got, err = renderTagTemplates([]string{"{{.Tag}}"}, newTagContext(build, time.Now()))
+	if err != nil || len(got) != 0 {
+		t.Errorf("Got tags %v, %v, want empty tag templates skipped", got, err)
+	}
+
+	for _, text := range []string{"{{.Branch", "{{.Unknown}}"} {
+		if _, err := renderTagTemplates([]string{text}, ctx); err == nil {
+			t.Errorf("Expect error for template %s", text)
+		}
+	}
+}
+
+func TestPluginTagsTemplates(t *testing.T) {
+	p := Plugin{Build: Build{
+		Name:         "8f51ad7884c5eb69c11d260a31da7a745e6b78e2",
+		Branch:       "feature/login",
+		Tags:         []string{"latest"},
+		TagTemplates: []string{"{{.Branch}}-{{.ShortSHA}}"},
+		SanitizeTags: true,
+	}}
+	got, err := p.tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"latest", "feature-login-8f51ad7"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got tags %v, want %v", got, want)
+	}
+
+	p.Build.TagTemplates = []string{"{{.Branch"}
+	if _, err := p.tags(); err == nil {
+		t.Errorf("Expect error for an invalid tag template")
+	}
+}
+
+func TestTagRef(t *testing.T) {
+	build := Build{Name: "d8dbe4d9", Repo: "octocat/hello-world"}
+	tests := []struct {
+		Tag  string
+		Ref  string
+		Repo string
+	}{
+		{Tag: "latest", Ref: "octocat/hello-world:latest", Repo: "octocat/hello-world"},
+		{Tag: "registry.example.com:5000/team/app:1.0", Ref: "registry.example.com:5000/team/app:1.0", Repo: "registry.example.com:5000/team/app"},
+		{Tag: "octocat/other:1.0", Ref: "octocat/other:1.0", Repo: "octocat/other"},
+	}
+	for _, test := range tests {
+		if got := build.tagRef(test.Tag); got != test.Ref {
+			t.Errorf("Got reference %s for tag %s, want %s", got, test.Tag, test.Ref)
+		}
+		if got := build.tagRepo(test.Tag); got != test.Repo {
+			t.Errorf("Got repository %s for tag %s, want %s", got, test.Tag, test.Repo)
+		}
+		if got := commandTag(build, test.Tag).Args; got[len(got)-1] != test.Ref {
+			t.Errorf("Got tag target %s, want %s", got[len(got)-1], test.Ref)
+		}
+	}
+
+	// mixed lists push the full references as-is
+	p := Plugin{Build: build}
+	p.Build.Tags = []string{"latest", "registry.example.com/team/app:1.0"}
+	p.Build.SanitizeTags = true
+	got, err := p.tags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"latest", "registry.example.com/team/app:1.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got tags %v, want %v", got, want)
+	}
+
+	p.Build.SanitizeTags = false
+	for _, tag := range []string{"feature/login", "registry.example.com:5000/team/app", "octocat/app@sha256:3b2a7c9e", "octocat/app:"} {
+		p.Build.Tags = []string{tag}
+		if _, err := p.tags(); err == nil {
+			t.Errorf("Expect error for tag %s", tag)
+		}
+	}
+}
+
+func Test_versionTags(t *testing.T) {
+	tests := []struct {
+		version string
+		suffix  string
+		want    []string
+	}{
+		{"1.2.3", "", []string{"1", "1.2", "1.2.3", "latest"}},
+		{"v1.2.3", "", []string{"1", "1.2", "1.2.3", "latest"}},
+		{"0.9.0", "", []string{"0.9", "0.9.0", "latest"}},
+		{"1.2.3-rc1", "", []string{"1.2.3-rc1"}},
+		{"1.2.3+build5", "", []string{"1.2.3-build5"}},
+		{"1.2.3-rc1+build5", "alpine", []string{"1.2.3-rc1-build5-alpine"}},
+		{"1.2.3", "alpine", []string{"1-alpine", "1.2-alpine", "1.2.3-alpine", "alpine"}},
+	}
+	for _, test := range tests {
+		got, err := versionTags(test.version, test.suffix)
+		if err != nil {
+			t.Errorf("Unexpected error for version %s: %s", test.version, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Got tags %v for version %s, want %v", got, test.version, test.want)
+		}
+	}
+	if _, err := versionTags("1.2", ""); err == nil {
+		t.Errorf("Expect error for an invalid semantic version")
+	}
+
+	p := Plugin{Build: Build{Tags: []string{"latest"}, AutoTag: true, Version: "2.0.0-beta.1"}}
+	if got, err := p.tags(); err != nil || !reflect.DeepEqual(got, []string{"2.0.0-beta.1"}) {
+		t.Errorf("Got tags %v, %v, want only the pre-release version tag", got, err)
+	}
+}
@@ -0,0 +1,93 @@
+package docker
+
+import (
+	"fmt"
+	"sort"
+)
+
+// helper function to build the Dockerfile stage and push it to its
+// mapped repository with the shared tags. The main build of Target
+// to Repo is unaffected; each mapped target is an additional build,
+// signed with Sign like the main build.
+func (p Plugin) buildTarget(target, repo string, tags []string) error {
+	p.Build.Name = fmt.Sprintf("%s-%s", p.Build.Name, target)
+	p.Build.Target = target
+	p.Build.Repo = repo
+	tags = p.Build.targetTags(tags)
+
+	if err := p.run(commandsBuild(p.Build)); err != nil {
+		return err
+	}
+	if err := p.postBuild(); err != nil {
+		return err
+	}
+
+	var (
+		cmds []buildahCmd
+		refs []string
+	)
+	for _, tag := range tags {
+		cmds = append(cmds, commandTag(p.Build, tag))
+		if p.Dryrun == false {
+			cmds = append(cmds, p.Build.pushStep(commandPush(p.Build, tag), tag))
+		}
+		refs = append(refs, p.Build.tagRef(tag))
+	}
+	if err := p.run(cmds); err != nil {
+		return err
+	}
+	if p.Build.Sign && p.Dryrun == false {
+		if err := p.sign(refs); err != nil {
+			return err
+		}
+	}
+
+	if p.Cleanup {
+		cmds = nil
+		for _, ref := range refs {
+			cmds = append(cmds, rmiStep(p.Build, ref))
+		}
+		cmds = append(cmds, rmiStep(p.Build, p.Build.Name))
+		return p.run(cmds)
+	}
+	return nil
+}
+
+// helper function to return the tags the mapped target is pushed with.
+// Full image references are skipped, since pushing the target to them
+// would overwrite the main image. With DigestOnly the target is pushed
+// under its own build name.
+func (b Build) targetTags(tags []string) []string {
+	var shared []string
+	for _, tag := range tags {
+		if !isImageRef(tag) {
+			shared = append(shared, tag)
+		}
+	}
+	return b.pushTags(shared)
+}
+
+// helper function to return the mapped targets in a stable order.
+func (b Build) mappedTargets() []string {
+	var targets []string
+	for target := range b.TargetMap {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	return targets
+}
+
+// helper function to validate the targets are named and mapped to
+// valid repositories.
+func (b Build) validateTargetMap() error {
+	for _, target := range b.mappedTargets() {
+		repo := b.TargetMap[target]
+		if target == "" {
+			return fmt.Errorf("Invalid target map: empty target for repository %s", repo)
+		}
+		if err := validateRepo(repo); err != nil {
+			return fmt.Errorf("Invalid repository %s for target %s: %s", repo, target, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_targetTags(t *testing.T) {
+	build := Build{Name: "d8dbe4d9-web", Repo: "octocat/web"}
+	tags := []string{"latest", "ghcr.io/octocat/hello-world:1.0", "1.0"}
+	if got, want := build.targetTags(tags), []string{"latest", "1.0"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got tags %v, want %v", got, want)
+	}
+	build.DigestOnly = true
+	if got, want := build.targetTags(tags), []string{"d8dbe4d9-web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got tags %v, want %v", got, want)
+	}
+}
+
+func Test_mappedTargets(t *testing.T) {
+	build := Build{TargetMap: map[string]string{"web": "octocat/web", "api": "octocat/api"}}
+	if got, want := build.mappedTargets(), []string{"api", "web"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Got targets %v, want %v", got, want)
+	}
+	if err := build.validateTargetMap(); err != nil {
+		t.Errorf("Unexpected error %s", err)
+	}
+
+	build.TargetMap["worker"] = "octocat/Worker"
+	want := `Invalid repository octocat/Worker for target worker: invalid repository component "Worker"`
+	if err := build.validateTargetMap(); err == nil || err.Error() != want {
+		t.Errorf("Got error %v, want %s", err, want)
+	}
+}
@@ -0,0 +1,81 @@
+package docker
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// waitDelay bounds the wait for a killed command when processes outside
+// its process group still hold its output open.
+const waitDelay = 5 * time.Second
+
+// helper function to run a command, killing it when it exceeds the
+// command timeout or the plugin run exceeds its timeout, or when the
+// abort channel reports an error. Once the plugin timeout is exceeded
+// the remaining commands are skipped. In preview mode the command is
+// not run at all. The command runs in its own process group and the
+// whole group is killed.
+func (p Plugin) runCmd(cmd *exec.Cmd) error {
+	if p.Preview {
+		return nil
+	}
+	if p.deadline.IsZero() && p.Build.CommandTimeout <= 0 && p.abort == nil {
+		return cmd.Run()
+	}
+	phase := strings.Join(redact(cmd.Args), " ")
+
+	limit, reason := p.Build.CommandTimeout, fmt.Sprintf("Command timeout after %s", p.Build.CommandTimeout)
+	if !p.deadline.IsZero() {
+		remaining := time.Until(p.deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("Timeout after %s, skipped %s", p.Timeout, phase)
+		}
+		if limit <= 0 || remaining < limit {
+			limit, reason = remaining, fmt.Sprintf("Timeout after %s", p.Timeout)
+		}
+	}
+
+	setProcessGroup(cmd)
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var expired <-chan time.Time
+	if limit > 0 {
+		timer := time.NewTimer(limit)
+		defer timer.Stop()
+		expired = timer.C
+	}
+	select {
+	case err := <-done:
+		return err
+	case <-expired:
+		killProcessGroup(cmd)
+		waitKilled(done)
+		return fmt.Errorf("%s while running %s", reason, phase)
+	case err := <-p.abort:
+		killProcessGroup(cmd)
+		waitKilled(done)
+		return fmt.Errorf("%s. Aborted %s", err, phase)
+	}
+}
+
+// helper function to wait for a killed command to exit. The wait gives
+// up after waitDelay, leaving the output copy to finish once the
+// processes holding it open exit.
+func waitKilled(done <-chan error) {
+	select {
+	case <-done:
+	case <-time.After(waitDelay):
+	}
+}
+
+// helper function to report whether the plugin run exceeded its
+// timeout.
+func (p Plugin) timedOut() bool {
+	return !p.deadline.IsZero() && time.Now().After(p.deadline)
+}
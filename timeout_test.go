@@ -0,0 +1,158 @@
+package docker
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_runCmdTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not found")
+	}
+
+	p := Plugin{Timeout: 50 * time.Millisecond, deadline: time.Now().Add(50 * time.Millisecond)}
+	start := time.Now()
+	err := p.runCmd(exec.Command("sleep", "10"))
+	if err == nil || !strings.Contains(err.Error(), "while running sleep 10") {
+		t.Errorf("Got error %v, want a timeout naming the command", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("Expect the command killed at the deadline")
+	}
+	if !p.timedOut() {
+		t.Errorf("Expect the run reported as timed out")
+	}
+
+	err = p.runCmd(exec.Command("sleep", "0"))
+	if err == nil || !strings.Contains(err.Error(), "skipped sleep 0") {
+		t.Errorf("Got error %v, want the command skipped", err)
+	}
+
+	p = Plugin{}
+	if err := p.runCmd(exec.Command("sleep", "0")); err != nil {
+		t.Errorf("Unexpected error without a timeout: %s", err)
+	}
+}
+
+func Test_runCmdCommandTimeout(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not found")
+	}
+
+	p := Plugin{Build: Build{CommandTimeout: 50 * time.Millisecond}}
+	err := p.runCmd(exec.Command("sleep", "10"))
+	if err == nil || !strings.Contains(err.Error(), "Command timeout after 50ms while running sleep 10") {
+		t.Errorf("Got error %v, want a command timeout naming the command", err)
+	}
+	if p.timedOut() {
+		t.Errorf("Unexpected plugin run timeout")
+	}
+	if err := p.runCmd(exec.Command("sleep", "0")); err != nil {
+		t.Errorf("Unexpected error for a command within the timeout: %s", err)
+	}
+
+	// the plugin timeout applies when it is reached first
+	p = Plugin{Timeout: 50 * time.Millisecond, deadline: time.Now().Add(50 * time.Millisecond), Build: Build{CommandTimeout: time.Minute}}
+	err = p.runCmd(exec.Command("sleep", "10"))
+	if err == nil || !strings.Contains(err.Error(), "Timeout after 50ms while running") {
+		t.Errorf("Got error %v, want the plugin timeout", err)
+	}
+}
+
+func Test_runCmdPreview(t *testing.T) {
+	p := Plugin{Preview: true}
+	cmd := exec.Command("false")
+	if err := p.runCmd(cmd); err != nil {
+		t.Errorf("Unexpected error in preview mode: %s", err)
+	}
+	if cmd.Process != nil {
+		t.Errorf("Expect the command not started in preview mode")
+	}
+}
+
+func TestExecTimeoutCleanup(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drone-buildah-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// buildah stand-in hanging on the build and logging the rmi calls
+	// with the storage config they run against
+	calls := filepath.Join(dir, "calls")
+	script := `#!/bin/sh
+case "$*" in
+version) echo "Version: 1.33.0" ;;
+bud*) exec sleep 10 ;;
+*" rmi "*) echo "$CONTAINERS_STORAGE_CONF $*" >> ` + calls + ` ;;
+esac
+`
+	if err := ioutil.WriteFile(filepath.Join(dir, buildahExe), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Setenv("PATH", os.Getenv("PATH"))
+	os.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "Dockerfile"), []byte("FROM alpine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := Plugin{
+		Build: Build{
+			Name:         "d8dbe4d9",
+			Repo:         "octocat/hello-world",
+			Tags:         []string{"latest"},
+			Dockerfile:   filepath.Join(dir, "Dockerfile"),
+			Context:      dir,
+			GraphRoot:    filepath.Join(dir, "storage"),
+			WarmContexts: []string{dir},
+		},
+		ConfigHome: dir,
+		Cleanup:    true,
+		Timeout:    500 * time.Millisecond,
+	}
+	if err := p.Exec(); err == nil {
+		t.Fatal("Expect the run to time out")
+	}
+	data, err := ioutil.ReadFile(calls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if !strings.Contains(line, "storage-") {
+			t.Errorf("Expect the rmi run against the generated storage config, got %q", line)
+		}
+	}
+	if !strings.Contains(string(data), "rmi d8dbe4d9") {
+		t.Errorf("Expect the built image removed, got %q", data)
+	}
+	if !strings.Contains(string(data), "rmi d8dbe4d9-warm-0") {
+		t.Errorf("Expect the warm image removed, got %q", data)
+	}
+}
+
+func Test_runCmdProcessGroup(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep not found")
+	}
+
+	// the background sleep keeps the output pipe open after the shell
+	// is killed unless the whole process group is killed
+	var out bytes.Buffer
+	cmd := exec.Command("sh", "-c", "sleep 10 & sleep 10")
+	cmd.Stdout = &out
+	p := Plugin{Build: Build{CommandTimeout: 50 * time.Millisecond}}
+	start := time.Now()
+	err := p.runCmd(cmd)
+	if err == nil || !strings.Contains(err.Error(), "Command timeout after 50ms") {
+		t.Errorf("Got error %v, want a command timeout", err)
+	}
+	if time.Since(start) > waitDelay {
+		t.Errorf("Expect the process group killed at the timeout")
+	}
+}
@@ -0,0 +1,78 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// helper function to build the variant, run the post build steps
+// against it and push it to the variant tag, signing it with Sign.
+func (p Plugin) buildVariant(variant Variant) error {
+	p.Build.Name = fmt.Sprintf("%s-%s", p.Build.Name, variant.Tag)
+	p.Build.Args = mergeArgs(p.Build.Args, variant.Args)
+
+	if err := p.run(commandsBuild(p.Build)); err != nil {
+		return err
+	}
+	if err := p.postBuild(); err != nil {
+		return err
+	}
+
+	cmds := []buildahCmd{commandTag(p.Build, variant.Tag)}
+	if p.Dryrun == false {
+		cmds = append(cmds, p.Build.pushStep(commandPush(p.Build, variant.Tag), variant.Tag))
+	}
+	if err := p.run(cmds); err != nil {
+		return err
+	}
+	if p.Build.Sign && p.Dryrun == false {
+		if err := p.sign([]string{p.Build.tagRef(variant.Tag)}); err != nil {
+			return err
+		}
+	}
+
+	if p.Cleanup {
+		return p.run([]buildahCmd{
+			rmiStep(p.Build, p.Build.tagRef(variant.Tag)),
+			rmiStep(p.Build, p.Build.Name),
+		})
+	}
+	return nil
+}
+
+// helper function to split the tags into the tags pushed from the
+// single shared build and the tags with their own build args. Tags
+// without tag args keep the fast path where one build is tagged many
+// times; each tag with tag args is rebuilt as a variant, so it costs a
+// full build of its own.
+func splitTagArgs(tags []string, tagArgs map[string][]string) ([]string, []Variant) {
+	var (
+		shared   []string
+		variants []Variant
+	)
+	for _, tag := range tags {
+		if args, ok := tagArgs[tag]; ok {
+			variants = append(variants, Variant{Tag: tag, Args: args})
+		} else {
+			shared = append(shared, tag)
+		}
+	}
+	return shared, variants
+}
+
+// helper function to merge KEY=VALUE build args, where the overrides
+// replace base args with the same key.
+func mergeArgs(base, overrides []string) []string {
+	keys := map[string]bool{}
+	for _, arg := range overrides {
+		keys[strings.SplitN(arg, "=", 2)[0]] = true
+	}
+
+	var merged []string
+	for _, arg := range base {
+		if !keys[strings.SplitN(arg, "=", 2)[0]] {
+			merged = append(merged, arg)
+		}
+	}
+	return append(merged, overrides...)
+}
@@ -0,0 +1,30 @@
+package docker
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_mergeArgs(t *testing.T) {
+	got := mergeArgs(
+		[]string{"BASE=alpine", "VERSION=1.0", "http_proxy=http://proxy"},
+		[]string{"BASE=debian", "DEBUG=1"},
+	)
+	want := []string{"VERSION=1.0", "http_proxy=http://proxy", "BASE=debian", "DEBUG=1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Got args %v, want %v", got, want)
+	}
+}
+
+func Test_splitTagArgs(t *testing.T) {
+	shared, variants := splitTagArgs(
+		[]string{"latest", "debug", "1.0"},
+		map[string][]string{"debug": {"DEBUG=1"}},
+	)
+	if want := []string{"latest", "1.0"}; !reflect.DeepEqual(shared, want) {
+		t.Errorf("Got shared tags %v, want %v", shared, want)
+	}
+	if want := []Variant{{Tag: "debug", Args: []string{"DEBUG=1"}}}; !reflect.DeepEqual(variants, want) {
+		t.Errorf("Got variants %v, want %v", variants, want)
+	}
+}
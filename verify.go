@@ -0,0 +1,61 @@
+package docker
+
+import (
+	"fmt"
+	"strings"
+)
+
+// check defines a single verification of an image.
+type check struct {
+	name string
+	run  func() error
+}
+
+// helper function to pull an existing image and run the configured
+// verifications against it, without building or pushing. Every check
+// runs, and the run fails when any of them fails.
+func (p Plugin) verifyImage() error {
+	image := p.Build.VerifyImage
+	p.Build.Name = image
+	p.Build.BuildOnlyStorage = false // the image must be pulled into the build storage
+
+	checks := p.checks(image)
+	if len(checks) == 0 {
+		return fmt.Errorf("No verification checks configured for %s", image)
+	}
+	if _, err := p.output(commandPull(p.Build, image)); err != nil {
+		return fmt.Errorf("Error pulling %s: %s", image, err)
+	}
+
+	var failed []string
+	for _, c := range checks {
+		if err := c.run(); err != nil {
+			fmt.Printf("FAIL %s: %s\n", c.name, err)
+			failed = append(failed, c.name)
+			continue
+		}
+		fmt.Printf("PASS %s\n", c.name)
+	}
+	if len(failed) != 0 {
+		return fmt.Errorf("Verification of %s failed: %d of %d checks failed (%s)", image, len(failed), len(checks), strings.Join(failed, ", "))
+	}
+	fmt.Printf("Verification of %s passed: %d checks\n", image, len(checks))
+	return nil
+}
+
+// helper function to return the verifications configured for the
+// image: the size budget, the entrypoint and cmd assertions and the
+// smoke test.
+func (p Plugin) checks(image string) []check {
+	var checks []check
+	if p.Build.MaxImageSize != "" {
+		checks = append(checks, check{"size budget", func() error { return p.checkImageSize(image, p.Build.MaxImageSize) }})
+	}
+	if p.Build.AssertEntrypoint != "" || len(p.Build.AssertCmd) != 0 {
+		checks = append(checks, check{"entrypoint", func() error { return p.checkEntrypoint(image) }})
+	}
+	if len(p.Build.SmokeTest) != 0 {
+		checks = append(checks, check{"smoke test", p.smokeTest})
+	}
+	return checks
+}
@@ -0,0 +1,24 @@
+package docker
+
+import "testing"
+
+func TestVerifyImageChecks(t *testing.T) {
+	p := Plugin{Build: Build{
+		VerifyImage:      "octocat/hello-world:1.0",
+		MaxImageSize:     "100MB",
+		AssertEntrypoint: "/bin/app",
+		SmokeTest:        []string{"/bin/app", "--version"},
+	}}
+	var names []string
+	for _, c := range p.checks(p.Build.VerifyImage) {
+		names = append(names, c.name)
+	}
+	if want := []string{"size budget", "entrypoint", "smoke test"}; !equalCommand(names, want) {
+		t.Errorf("Got checks %v, want %v", names, want)
+	}
+
+	p = Plugin{Build: Build{VerifyImage: "octocat/hello-world:1.0"}}
+	if err := p.verifyImage(); err == nil {
+		t.Errorf("Expect error when no checks are configured")
+	}
+}
@@ -0,0 +1,83 @@
+package docker
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// matches the version reported by buildah version, e.g. Version: 1.23.1
+var buildahVersionLine = regexp.MustCompile(`(?m)^Version:\s+v?(\S+)`)
+
+// helper function to read the installed buildah version, streaming
+// the version output to the logs unless quiet.
+func (p Plugin) buildahVersion(quiet bool) (string, error) {
+	out, err := p.output(commandVersion())
+	if !quiet {
+		os.Stdout.Write(out)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Error reading buildah version: %s", err)
+	}
+
+	match := buildahVersionLine.FindSubmatch(out)
+	if match == nil {
+		return "", fmt.Errorf("Error reading buildah version: no version found")
+	}
+	return string(match[1]), nil
+}
+
+// helper function to check the installed buildah is at least the
+// minimum version.
+func (p Plugin) checkVersion(version string) error {
+	older, err := olderVersion(version, p.MinBuildahVersion)
+	if err != nil {
+		return fmt.Errorf("Error comparing buildah version: %s", err)
+	}
+	if older {
+		return fmt.Errorf("Buildah %s is older than the required version %s", version, p.MinBuildahVersion)
+	}
+	return nil
+}
+
+// helper function to parse a semantic version into its major, minor
+// and patch numbers. Pre-release and build suffixes are ignored.
+func parseVersion(s string) ([3]int, error) {
+	var version [3]int
+	s = strings.TrimPrefix(s, "v")
+	if i := strings.IndexAny(s, "-+"); i != -1 {
+		s = s[:i]
+	}
+	parts := strings.Split(s, ".")
+	if len(parts) > 3 {
+		return version, fmt.Errorf("invalid version %q", s)
+	}
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return version, fmt.Errorf("invalid version %q", s)
+		}
+		version[i] = n
+	}
+	return version, nil
+}
+
+// helper function to report whether version a is older than version b.
+func olderVersion(a, b string) (bool, error) {
+	va, err := parseVersion(a)
+	if err != nil {
+		return false, err
+	}
+	vb, err := parseVersion(b)
+	if err != nil {
+		return false, err
+	}
+	for i := range va {
+		if va[i] != vb[i] {
+			return va[i] < vb[i], nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,38 @@
+package docker
+
+import "testing"
+
+func Test_olderVersion(t *testing.T) {
+	tests := []struct {
+		A, B string
+		Want bool
+	}{
+		{A: "1.23.1", B: "1.23.1", Want: false},
+		{A: "1.23.1", B: "1.24", Want: true},
+		{A: "1.9.0", B: "1.10.0", Want: true},
+		{A: "2.0.0", B: "1.30.5", Want: false},
+		{A: "1.24.0-dev", B: "1.24.0", Want: false},
+		{A: "v1.23", B: "1.23.0", Want: false},
+	}
+	for _, test := range tests {
+		got, err := olderVersion(test.A, test.B)
+		if err != nil {
+			t.Errorf("Unexpected error comparing %s and %s: %s", test.A, test.B, err)
+		}
+		if got != test.Want {
+			t.Errorf("Got older %v for %s and %s, want %v", got, test.A, test.B, test.Want)
+		}
+	}
+
+	if _, err := olderVersion("1.x", "1.0"); err == nil {
+		t.Errorf("Expect error for invalid version")
+	}
+}
+
+func Test_buildahVersion(t *testing.T) {
+	out := "Version:         1.23.1\nGo Version:      go1.17.2\nImage Spec:      1.0.1-dev\n"
+	match := buildahVersionLine.FindStringSubmatch(out)
+	if match == nil || match[1] != "1.23.1" {
+		t.Errorf("Got version match %v, want 1.23.1", match)
+	}
+}
@@ -0,0 +1,52 @@
+package docker
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// helper function to build each warm context purely to populate the
+// layer cache. Contexts are given as context[:dockerfile], where the
+// Dockerfile defaults to the Dockerfile inside the context. Nothing is
+// tagged or pushed; the warm images are removed with the cleanup.
+func (p Plugin) warmCache() error {
+	names := p.Build.warmImages()
+	for i, entry := range p.Build.WarmContexts {
+		build := p.Build
+		build.Context, build.Dockerfile = splitWarmContext(entry)
+		build.Name = names[i]
+		build.Layers = true
+
+		fmt.Printf("Warming cache with context %s (%d/%d)\n", build.Context, i+1, len(p.Build.WarmContexts))
+		err := p.run([]buildahCmd{commandBuild(build)})
+		if err == nil {
+			continue
+		}
+		if !p.Build.WarmContinueOnError {
+			return fmt.Errorf("Error warming cache with context %s: %s", build.Context, err)
+		}
+		fmt.Printf("Could not warm cache with context %s. Ignoring...\n", build.Context)
+	}
+	return nil
+}
+
+// helper function to return the names of the images built for the warm
+// contexts.
+func (b Build) warmImages() []string {
+	var names []string
+	for i := range b.WarmContexts {
+		names = append(names, fmt.Sprintf("%s-warm-%d", b.Name, i))
+	}
+	return names
+}
+
+// helper function to split a warm context entry into the context and
+// the Dockerfile.
+func splitWarmContext(entry string) (string, string) {
+	parts := strings.SplitN(entry, ":", 2)
+	if len(parts) == 2 && parts[1] != "" {
+		return parts[0], parts[1]
+	}
+	return parts[0], filepath.Join(parts[0], "Dockerfile")
+}
@@ -0,0 +1,16 @@
+package docker
+
+import "testing"
+
+func Test_splitWarmContext(t *testing.T) {
+	tests := map[string][2]string{
+		"services/api":                   {"services/api", "services/api/Dockerfile"},
+		"services/web:docker/Dockerfile": {"services/web", "docker/Dockerfile"},
+	}
+	for entry, want := range tests {
+		context, dockerfile := splitWarmContext(entry)
+		if context != want[0] || dockerfile != want[1] {
+			t.Errorf("Got %s and %s for %s, want %v", context, dockerfile, entry, want)
+		}
+	}
+}